@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"os"
 
+	"vilks.io/vilks/logger"
 	"vilks.io/vilks/scenario"
 
 	"github.com/spf13/cobra"
@@ -32,7 +33,7 @@ func runExec(cmd *cobra.Command, _ []string) error {
 		attackerIP = ip
 	}
 
-	if scenarioPath == "" {
+	if len(scenarioPaths) == 0 {
 		return errors.New("scenario file is required")
 	}
 
@@ -44,15 +45,30 @@ func runExec(cmd *cobra.Command, _ []string) error {
 		return errors.New("evidence directory is required")
 	}
 
+	runID, err := newRunID()
+	if err != nil {
+		return fmt.Errorf("failed to generate run ID: %s", err.Error())
+	}
+
 	log.Info("Loading scenario...")
 
-	scene, err := scenario.New(cmd.Context(), log, evidencePath, scenarioPath, recipesDir)
+	scene, err := scenario.New(cmd.Context(), log, evidencePath, scenarioPaths, overrides, recipesDir)
 	if err != nil {
 		log.Error("Failed to load scenario: " + err.Error())
 		os.Exit(1)
 	}
 
+	if err := scene.ResolveParams(); err != nil {
+		log.Error("Failed to resolve scenario parameters: " + err.Error())
+		os.Exit(1)
+	}
+
+	log = logger.Masked(log, scene.Secrets())
+
 	scene.SetAttackerHost(attackerIP)
+	scene.SetRunID(runID)
+
+	log.Debug("Run ID: " + runID)
 
 	for _, team := range scene.Teams() {
 		if teamName != "" && team.Name != teamName {
@@ -71,6 +87,13 @@ func runExec(cmd *cobra.Command, _ []string) error {
 
 				log.Info("Team: " + log.Special(team.Name))
 				log.Info("Host: " + log.Special(host))
+
+				if err := scene.CheckEngagement(cmd.Context(), team.Name, host); err != nil {
+					log.Error("Attack " + attack + " skipped: " + err.Error())
+
+					continue
+				}
+
 				log.Info("Starting attack " + log.Special(attack))
 
 				if err := scene.Execute(cmd.Context(), team.Name, host, attack); err != nil {
@@ -97,8 +120,7 @@ func init() {
 		RunE:  runExec,
 	}
 
-	cmd.Flags().StringVarP(&scenarioPath, "scenario", "s", scenarioPath, "Path to scenario file")
-	_ = cmd.MarkFlagRequired("scenario")
+	addScenarioFlags(cmd)
 	cmd.Flags().StringVarP(&recipesDir, "recipes", "r", recipesDir, "Path to recipes directory")
 	_ = cmd.MarkFlagRequired("recipes")
 	cmd.Flags().StringVarP(&evidencePath, "evidence", "e", evidencePath, "Path to evidence directory")
@@ -0,0 +1,147 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"vilks.io/vilks/runner"
+	"vilks.io/vilks/runner/docker"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	gcOlderThan time.Duration
+	gcDryRun    bool
+	gcAll       bool
+)
+
+// isOrphan checks if resource belongs to a run that is no longer alive.
+// Process start is compared as well when available, so that process reusing
+// pid of the run is not mistaken for it. Resources of runs started on other
+// hosts are considered alive as their liveness can not be checked, use --all
+// to include them.
+func isOrphan(res runner.Resource) bool {
+	origin, _ := os.Hostname()
+	if res.Labels[runner.LabelOrigin] != origin {
+		return false
+	}
+
+	pid, err := strconv.Atoi(res.Labels[runner.LabelPID])
+	if err != nil {
+		return false
+	}
+
+	if !isProcessAlive(pid) {
+		return true
+	}
+
+	if start := res.Labels[runner.LabelPIDStart]; start != "" {
+		if current, err := runner.ProcessStart(pid); err == nil && current != start {
+			return true
+		}
+	}
+
+	return false
+}
+
+func runGC(cmd *cobra.Command, _ []string) error {
+	resources, err := docker.ListResources(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("failed to list resources: %s", err.Error())
+	}
+
+	var count int
+
+	for _, res := range resources {
+		if !gcAll && !isOrphan(res) {
+			continue
+		}
+
+		if time.Since(res.Created) < gcOlderThan {
+			continue
+		}
+
+		count++
+
+		name := res.Labels[runner.LabelStep]
+		if name == "" {
+			name = res.Labels[runner.LabelService]
+		}
+
+		log.Info(fmt.Sprintf("Found %s %s", res.Kind, log.Special(res.ID[:12])), map[string]string{
+			"run":     res.Labels[runner.LabelRunID],
+			"team":    res.Labels[runner.LabelTeam],
+			"host":    res.Labels[runner.LabelHost],
+			"attack":  res.Labels[runner.LabelAttack],
+			"recipe":  res.Labels[runner.LabelRecipe],
+			"name":    name,
+			"created": res.Created.Format(time.RFC3339),
+		})
+
+		if gcDryRun {
+			continue
+		}
+
+		if err := docker.RemoveResource(cmd.Context(), res); err != nil {
+			log.Error(fmt.Sprintf("Failed to remove %s %s: %s", res.Kind, res.ID[:12], err.Error()))
+
+			continue
+		}
+
+		log.Debug(fmt.Sprintf("Removed %s %s", res.Kind, res.ID[:12]))
+	}
+
+	rules, err := docker.StaleFirewallRules(cmd.Context())
+	if err != nil {
+		log.Warn(fmt.Sprintf("Failed to list firewall rules: %s", err.Error()))
+	}
+
+	for _, rule := range rules {
+		count++
+
+		log.Info(fmt.Sprintf("Found firewall rule of container %s", log.Special(rule.ContainerID)), map[string]string{
+			"rule": rule.String(),
+		})
+
+		if gcDryRun {
+			continue
+		}
+
+		if err := docker.RemoveFirewallRule(cmd.Context(), rule); err != nil {
+			log.Error(fmt.Sprintf("Failed to remove firewall rule: %s", err.Error()))
+
+			continue
+		}
+
+		log.Debug("Removed firewall rule " + rule.String())
+	}
+
+	if count == 0 {
+		log.Info("No leftover resources found")
+	}
+
+	return nil
+}
+
+func init() {
+	initRootCmd()
+
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Remove leftover resources",
+		Long:  `List or remove containers, networks and egress firewall rules left behind by runs that are no longer alive.`,
+		RunE:  runGC,
+	}
+
+	cmd.Flags().DurationVar(&gcOlderThan, "older-than", gcOlderThan, "Only include resources older than given duration")
+	cmd.Flags().BoolVar(&gcDryRun, "dry-run", gcDryRun, "Only list resources without removing them")
+	cmd.Flags().BoolVar(&gcAll, "all", gcAll, "Include resources of runs that are still alive or started on other hosts")
+
+	RootCmd.AddCommand(cmd)
+}
@@ -0,0 +1,119 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"vilks.io/vilks/nmap"
+	"vilks.io/vilks/scenario"
+
+	"github.com/goccy/go-yaml"
+	"github.com/spf13/cobra"
+)
+
+// addScenarioFlags adds flags to load scenario from multiple files and overrides.
+func addScenarioFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVarP(&scenarioPaths, "scenario", "s", scenarioPaths, "Path to scenario file, can be repeated to overlay files")
+	_ = cmd.MarkFlagRequired("scenario")
+	cmd.Flags().StringArrayVar(&overrides, "set", overrides, "Override scenario value in form key=value, e.g. teams.Team 1.index=3")
+}
+
+func runScenarioRender(cmd *cobra.Command, _ []string) error {
+	if len(scenarioPaths) == 0 {
+		return errors.New("scenario is required")
+	}
+
+	s, err := scenario.LoadFiles(cmd.Context(), scenarioPaths, overrides)
+	if err != nil {
+		return err
+	}
+
+	s.MaskSecrets()
+
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(string(data))
+
+	return nil
+}
+
+var nmapTeams []string
+
+func runScenarioImportNmap(_ *cobra.Command, args []string) error {
+	if len(args) == 0 && len(nmapTeams) == 0 {
+		return errors.New("nmap XML file is required")
+	}
+
+	scans := make([]scenario.TeamScan, 0, len(args)+len(nmapTeams))
+
+	for _, path := range args {
+		run, err := nmap.ParseFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read '%s': %w", path, err)
+		}
+
+		scans = append(scans, scenario.TeamScan{Run: run})
+	}
+
+	for _, t := range nmapTeams {
+		team, path, ok := strings.Cut(t, "=")
+		if !ok || team == "" || path == "" {
+			return fmt.Errorf("invalid team scan '%s', expected team=file", t)
+		}
+
+		run, err := nmap.ParseFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read '%s': %w", path, err)
+		}
+
+		scans = append(scans, scenario.TeamScan{Team: team, Run: run})
+	}
+
+	data, err := yaml.Marshal(scenario.ImportNmap(scans))
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(string(data))
+
+	return nil
+}
+
+func init() {
+	initRootCmd()
+
+	cmd := &cobra.Command{
+		Use:   "scenario",
+		Short: "Scenario tools",
+		Long:  `Tools to work with scenario files.`,
+	}
+
+	render := &cobra.Command{
+		Use:   "render",
+		Short: "Render merged scenario",
+		Long:  `Print scenario merged from included files, overlays and overrides.`,
+		RunE:  runScenarioRender,
+	}
+
+	addScenarioFlags(render)
+
+	importNmap := &cobra.Command{
+		Use:   "import-nmap [file.xml...]",
+		Short: "Propose hosts from nmap scan",
+		Long:  `Print scenario fragment with hosts, targets and ports discovered in nmap XML output, that can be included in scenario.`,
+		RunE:  runScenarioImportNmap,
+	}
+
+	importNmap.Flags().StringArrayVar(&nmapTeams, "team", nmapTeams, "Team scan in form team=file.xml, can be repeated")
+
+	cmd.AddCommand(render, importNmap)
+
+	RootCmd.AddCommand(cmd)
+}
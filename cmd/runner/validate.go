@@ -13,12 +13,13 @@ import (
 )
 
 var (
-	scenarioPath string
-	recipesDir   string
+	scenarioPaths []string
+	overrides     []string
+	recipesDir    string
 )
 
 func runValidate(cmd *cobra.Command, _ []string) error {
-	if scenarioPath == "" {
+	if len(scenarioPaths) == 0 {
 		return errors.New("scenario are required")
 	}
 
@@ -26,7 +27,7 @@ func runValidate(cmd *cobra.Command, _ []string) error {
 		return errors.New("recipes are required")
 	}
 
-	scene, err := scenario.New(cmd.Context(), log, "", scenarioPath, recipesDir)
+	scene, err := scenario.New(cmd.Context(), log, "", scenarioPaths, overrides, recipesDir)
 	if err != nil {
 		log.Error("Failed to load scenario: " + err.Error())
 		os.Exit(1)
@@ -52,8 +53,7 @@ func init() {
 		RunE:  runValidate,
 	}
 
-	cmd.Flags().StringVarP(&scenarioPath, "scenario", "s", scenarioPath, "Path to scenario file")
-	_ = cmd.MarkFlagRequired("scenario")
+	addScenarioFlags(cmd)
 	cmd.Flags().StringVarP(&recipesDir, "recipes", "r", recipesDir, "Path to recipes directory")
 	_ = cmd.MarkFlagRequired("recipes")
 
@@ -4,15 +4,21 @@
 package evidence
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"mime"
 	"os"
 	"path/filepath"
 	"time"
+
+	"vilks.io/vilks/secret"
 )
 
 type Evidence interface {
 	AddEvidence(name, typ string, data []byte) error
+	// Stream returns writer that stores data to evidence as it is written.
+	Stream(name, typ string) (io.WriteCloser, error)
 }
 
 func New(baseDir string) *Manager {
@@ -56,3 +62,109 @@ func (i *inst) AddEvidence(name, typ string, data []byte) error {
 
 	return os.WriteFile(filepath.Join(i.baseDir, t+"_"+name+exts[0]), data, 0o600)
 }
+
+func (i *inst) Stream(name, typ string) (io.WriteCloser, error) {
+	exts, err := mime.ExtensionsByType(typ)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(exts) == 0 {
+		return nil, fmt.Errorf("unknown mime type: %s", typ)
+	}
+
+	t := time.Now().Format("20060102150405")
+
+	f, err := os.OpenFile(filepath.Join(i.baseDir, t+"_"+name+exts[0]), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileStream{f: f}, nil
+}
+
+// fileStream writes evidence to file, empty file is removed on close.
+type fileStream struct {
+	f *os.File
+	n int
+}
+
+func (s *fileStream) Write(p []byte) (int, error) {
+	n, err := s.f.Write(p)
+	s.n += n
+
+	return n, err
+}
+
+func (s *fileStream) Close() error {
+	if err := s.f.Close(); err != nil {
+		return err
+	}
+
+	if s.n == 0 {
+		return os.Remove(s.f.Name())
+	}
+
+	return nil
+}
+
+type masked struct {
+	ev Evidence
+	m  *secret.Masker
+}
+
+// Masked returns evidence store that masks secret values in stored data.
+func Masked(ev Evidence, m *secret.Masker) Evidence {
+	return &masked{ev: ev, m: m}
+}
+
+func (e *masked) AddEvidence(name, typ string, data []byte) error {
+	return e.ev.AddEvidence(e.m.Mask(name), typ, e.m.MaskBytes(data))
+}
+
+// Stream masks data line by line so that secrets split between writes are masked.
+func (e *masked) Stream(name, typ string) (io.WriteCloser, error) {
+	w, err := e.ev.Stream(e.m.Mask(name), typ)
+	if err != nil {
+		return nil, err
+	}
+
+	return &maskedStream{w: w, m: e.m}, nil
+}
+
+// maxStreamLine is the maximum length of incomplete line buffered for masking.
+const maxStreamLine = 64 << 10
+
+type maskedStream struct {
+	w   io.WriteCloser
+	m   *secret.Masker
+	buf bytes.Buffer
+}
+
+func (s *maskedStream) Write(p []byte) (int, error) {
+	s.buf.Write(p)
+
+	i := bytes.LastIndexByte(s.buf.Bytes(), '\n') + 1
+	if i == 0 && s.buf.Len() > maxStreamLine {
+		// Do not buffer output without new lines indefinitely.
+		i = s.buf.Len()
+	}
+
+	if i > 0 {
+		if _, err := s.w.Write(s.m.MaskBytes(s.buf.Next(i))); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// Close writes remaining incomplete line.
+func (s *maskedStream) Close() error {
+	if s.buf.Len() > 0 {
+		_, _ = s.w.Write(s.m.MaskBytes(s.buf.Bytes()))
+		s.buf.Reset()
+	}
+
+	return s.w.Close()
+}
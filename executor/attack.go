@@ -10,18 +10,20 @@ import (
 	"fmt"
 	"io"
 	"maps"
+	"net"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"vilks.io/vilks/recipe"
 	"vilks.io/vilks/runner"
 	"vilks.io/vilks/runner/docker"
-
-	"github.com/drone/envsubst"
+	"vilks.io/vilks/template"
 )
 
 type Attack struct {
@@ -31,6 +33,12 @@ type Attack struct {
 	Recipe   *recipe.Recipe
 	Params   map[string]string
 	Evidence map[string]string
+
+	services     []*service
+	steps        map[string]*recipe.StepResult
+	mu           sync.Mutex
+	network      string
+	workspaceDir string
 }
 
 type ErrCommandFailed struct {
@@ -41,6 +49,14 @@ func (e ErrCommandFailed) Error() string {
 	return fmt.Sprintf("command failed: %s", e.Output)
 }
 
+type ErrOutOfMemory struct {
+	Command string
+}
+
+func (e ErrOutOfMemory) Error() string {
+	return fmt.Sprintf("command was killed because container ran out of memory: %s", e.Command)
+}
+
 func (a *Attack) Values() map[string]string {
 	prms := make(map[string]string, len(a.Recipe.Params)+1)
 
@@ -54,6 +70,11 @@ func (a *Attack) Values() map[string]string {
 		prms["team_"+k] = v
 	}
 
+	// Add host parameters.
+	for k, v := range a.executor.HostParams {
+		prms["host_"+k] = v
+	}
+
 	// Add attack parameters.
 	prms["attack_name"] = a.executor.AttackName
 	for k, v := range a.executor.GlobalParams {
@@ -71,7 +92,117 @@ func (a *Attack) Values() map[string]string {
 	return prms
 }
 
-func (a *Attack) prepareWorkspace(ctx context.Context, r runner.Runner) (string, error) {
+func (a *Attack) labels(kind, name string) map[string]string {
+	labels := map[string]string{
+		runner.LabelRunID:  a.executor.RunID,
+		runner.LabelPID:    strconv.Itoa(os.Getpid()),
+		runner.LabelTeam:   a.executor.TeamName,
+		runner.LabelHost:   a.executor.HostName,
+		runner.LabelAttack: a.executor.AttackName,
+		runner.LabelRecipe: a.Recipe.Name,
+	}
+
+	if kind != "" {
+		labels[kind] = name
+	}
+
+	if origin, err := os.Hostname(); err == nil {
+		labels[runner.LabelOrigin] = origin
+	}
+
+	if start, err := runner.ProcessStart(os.Getpid()); err == nil {
+		labels[runner.LabelPIDStart] = start
+	}
+
+	return labels
+}
+
+// networks returns networks to connect container to. Static address is
+// assigned only to step containers.
+func (a *Attack) networks(svc *recipe.Service) []runner.NetworkAttachment {
+	networks := make([]runner.NetworkAttachment, 0, 2)
+
+	if a.executor.Network != "" {
+		n := runner.NetworkAttachment{
+			Name: a.executor.Network,
+		}
+
+		if svc == nil {
+			n.IPAddress = a.executor.NetworkAddress
+		}
+
+		networks = append(networks, n)
+	}
+
+	if a.network != "" {
+		n := runner.NetworkAttachment{
+			Name: a.network,
+		}
+
+		if svc != nil {
+			n.Aliases = []string{svc.Hostname()}
+		}
+
+		networks = append(networks, n)
+	}
+
+	return networks
+}
+
+// expand substitutes parameter references in s. Filtered secret values, e.g.
+// base64 encoded passwords, are masked the same way as secrets.
+func (a *Attack) expand(s string, params map[string]string) (string, error) {
+	return template.ExpandFiltered(s, params, a.executor.Secrets.AddDerived)
+}
+
+// egress returns egress rules for step and service containers. Attacker host
+// is always allowed so that steps can reach services.
+func (a *Attack) egress() []runner.EgressRule {
+	if !a.executor.RestrictEgress {
+		return nil
+	}
+
+	rules := slices.Clone(a.executor.Egress)
+
+	if ip := net.ParseIP(a.executor.AttackerHost); ip != nil {
+		bits := 128
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+
+		rules = append(rules, runner.EgressRule{Network: fmt.Sprintf("%s/%d", ip, bits)})
+	}
+
+	return rules
+}
+
+func (a *Attack) createNetwork(ctx context.Context) (func(), error) {
+	if a.Recipe.Network == nil || !a.Recipe.Network.Isolated {
+		return func() {}, nil
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := docker.CreateNetwork(ctx, "vilks-"+token, a.labels("", ""))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create attack network: %w", err)
+	}
+
+	a.network = id
+
+	return func() {
+		if err := docker.RemoveNetwork(context.WithoutCancel(ctx), id); err != nil {
+			a.executor.log.Error("Failed to remove attack network: " + err.Error())
+		}
+
+		a.network = ""
+	}, nil
+}
+
+func (a *Attack) prepareWorkspace(ctx context.Context, r runner.Runner, params map[string]string) (string, error) {
 	dir, err := os.MkdirTemp("", "vilks-workspace-")
 	if err != nil {
 		return "", err
@@ -90,7 +221,21 @@ func (a *Attack) prepareWorkspace(ctx context.Context, r runner.Runner) (string,
 	}
 
 	for _, item := range a.Recipe.Workspace {
-		if err := copySource(filepath.Join(dir, item.Target), item.Source); err != nil {
+		target, err := a.expand(item.Target, params)
+		if err != nil {
+			_ = os.RemoveAll(dir)
+
+			return "", err
+		}
+
+		source, err := a.expand(item.Source, params)
+		if err != nil {
+			_ = os.RemoveAll(dir)
+
+			return "", err
+		}
+
+		if err := copySource(filepath.Join(dir, target), source); err != nil {
 			_ = os.RemoveAll(dir)
 
 			return "", err
@@ -121,138 +266,113 @@ func (a *Attack) prepareEvidenceStore(ctx context.Context, r runner.Runner) (str
 	return dir, nil
 }
 
-func (a *Attack) startServices(ctx context.Context) ([]runner.Runner, map[string]string, error) {
-	services := make([]runner.Runner, 0, len(a.Recipe.Services))
-	params := make(map[string]string, len(a.Recipe.Services))
-
-	for _, svc := range a.Recipe.Services {
-		a.executor.log.Info("Starting service " + a.executor.log.Special(svc.Name))
+// setEvidence sets evidence value, it is safe to call from concurrent step iterations.
+func (a *Attack) setEvidence(name, value string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 
-		r := docker.New()
-		ports := make([]string, len(svc.Ports))
+	a.Evidence[name] = value
+}
 
-		for i, p := range svc.Ports {
-			hp, err := assignFreePort()
-			if err != nil {
-				a.stopServices(ctx, services)
+func (a *Attack) executeStep(ctx context.Context, r runner.Runner, step *recipe.Step, it *iteration, res *recipe.StepResult, evidenceDir string, params map[string]string) error {
+	var waitOffset int
 
-				return nil, nil, err
-			}
+	if step.Wait != nil {
+		s := a.service(step.Wait.Service)
+		if s == nil {
+			return fmt.Errorf("step '%s' waits for unknown service '%s'", step.Name, step.Wait.Service)
+		}
 
-			a.executor.log.Debug(fmt.Sprintf("Assigning port %d to %s", hp, p.Port))
+		waitOffset = s.Size()
+	}
 
-			params[p.Name] = strconv.FormatInt(int64(hp), 10)
-			ports[i] = fmt.Sprintf("%d:%s", hp, p.Port)
+	if step.Image != "" {
+		res, err := a.resources(step.Resources)
+		if err != nil {
+			return err
 		}
 
 		if err := r.Start(ctx, runner.StartOptions{
-			Image:      svc.Image,
-			Service:    true,
-			Ports:      ports,
-			Entrypoint: []string{"/bin/sh", "-c", svc.Command},
+			Image:     step.Image,
+			Timeout:   20 * time.Minute,
+			Shell:     "/bin/sh",
+			Labels:    a.labels(runner.LabelStep, step.Name),
+			Networks:  a.networks(nil),
+			Resources: res,
+
+			User:        step.User,
+			CapAdd:      step.CapAdd,
+			CapDrop:     step.CapDrop,
+			Privileged:  step.Privileged,
+			ReadOnly:    step.ReadOnly,
+			SecurityOpt: step.SecurityOpt,
+
+			RestrictEgress: a.executor.RestrictEgress,
+			Egress:         a.egress(),
 		}); err != nil {
-			a.stopServices(ctx, services)
-
-			return nil, nil, err
+			return err
 		}
 
-		services = append(services, r)
+		defer func() {
+			// Clean up even if attack was aborted.
+			_ = r.Stop(context.WithoutCancel(ctx))
+		}()
+	} else if len(step.Commands) > 0 {
+		return fmt.Errorf("step '%s' has commands but no image", step.Name)
 	}
 
-	return services, params, nil
-}
-
-func (a *Attack) stopServices(ctx context.Context, services []runner.Runner) {
-	for _, s := range services {
-		_ = s.Stop(ctx)
-	}
-}
-
-func (a *Attack) executeStep(ctx context.Context, r runner.Runner, step *recipe.Step, evidenceDir string, params map[string]string) error {
-	if err := r.Start(ctx, runner.StartOptions{
-		Image:   step.Image,
-		Timeout: 20 * time.Minute,
-		Shell:   "/bin/sh",
-	}); err != nil {
-		return err
-	}
-
-	defer func() {
-		_ = r.Stop(ctx)
-	}()
-
 	var buf bytes.Buffer
 
-	for _, cmd := range step.Commands {
-		t, err := envsubst.Parse(cmd)
+	for _, c := range step.Commands {
+		cmd, err := a.expand(c.Run, params)
 		if err != nil {
-			return err
+			return &ErrCommandFailed{Output: []byte(err.Error())}
 		}
 
-		cmd, err = t.Execute(func(s string) string {
-			for k, v := range params {
-				if strings.EqualFold(s, k) {
-					return v
-				}
-			}
+		a.executor.log.Debug("Executing command: " + cmd)
 
-			return ""
-		})
+		out, err := a.execCommand(ctx, r, step, it, c, cmd, params)
 		if err != nil {
 			return err
 		}
 
-		a.executor.log.Debug("Executing command: " + cmd)
+		res.ExitCode = out.ExitCode
 
-		out, err := r.Exec(ctx, step.Environ(params), "/bin/sh", "-c", cmd)
-		if err != nil {
-			return err
+		if out.OOMKilled {
+			return &ErrOutOfMemory{Command: cmd}
 		}
 
-		if out.ExitCode != 0 {
-			output := out.Stderr
-			if len(output) == 0 {
-				output = out.Stdout
+		if err := checkCommand(c, step.Conditions, out); err != nil {
+			if !c.AllowFailure {
+				return err
 			}
 
-			return &ErrCommandFailed{Output: output}
+			a.executor.log.Debug("Ignoring allowed command failure: " + err.Error())
 		}
 
-		if step.Conditions != nil {
-			if step.Conditions.SuccessRegexp != "" {
-				r, err := regexp.Compile(step.Conditions.SuccessRegexp)
-				if err != nil {
-					return err
-				}
-
-				if !r.Match(out.Stdout) {
-					return &ErrCommandFailed{Output: []byte(fmt.Sprintf("output did not match success regexp '%s'", step.Conditions.SuccessRegexp))}
-				}
-			}
-
-			if step.Conditions.FailureRegexp != "" {
-				r, err := regexp.Compile(step.Conditions.FailureRegexp)
-				if err != nil {
-					return err
-				}
+		if c.Capture != "" {
+			a.setEvidence(c.Capture+it.suffix(), strings.TrimSpace(string(out.Stdout)))
+		}
 
-				if r.Match(out.Stdout) {
-					return &ErrCommandFailed{Output: []byte(fmt.Sprintf("output matched failure regexp '%s'", step.Conditions.FailureRegexp))}
-				}
-			}
+		if c.IgnoreOutput {
+			continue
 		}
 
-		if err := a.executor.ev.AddEvidence(step.Name+"_output", "text/plain", out.Stdout); err != nil {
+		if err := a.executor.ev.AddEvidence(step.Name+it.suffix()+"_output", "text/plain", out.Stdout); err != nil {
 			return err
 		}
 
-		a.executor.log.Console("Command output", out.Stdout)
-
 		if _, err = buf.Write(out.Stdout); err != nil {
 			return err
 		}
 	}
 
+	if step.Wait != nil {
+		if err := a.waitService(ctx, step.Wait, params, waitOffset); err != nil {
+			return err
+		}
+	}
+
 	for _, ev := range step.Evidence {
 		switch ev.Type {
 		case recipe.EvidenceTypeFile:
@@ -273,21 +393,14 @@ func (a *Attack) executeStep(ctx context.Context, r runner.Runner, step *recipe.
 					return err
 				}
 
-				var s bytes.Buffer
-				for i, m := range r.FindAll(buf.Bytes(), -1) {
-					if i > 0 {
-						s.WriteByte('\n')
-					}
-					s.Write(m)
-				}
-
-				if s.Len() == 0 {
+				m := findAll(r, buf.Bytes())
+				if len(m) == 0 {
 					return fmt.Errorf("evidence regexp '%s' did not match any content in '%s'", ev.Regexp, ev.Path)
 				}
 
-				a.Evidence[ev.Name] = s.String()
+				a.setEvidence(ev.Name+it.suffix(), m)
 			} else {
-				dst := filepath.Join(evidenceDir, ev.Name+filepath.Ext(ev.Path))
+				dst := filepath.Join(evidenceDir, ev.Name+it.suffix()+filepath.Ext(ev.Path))
 				f, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY, 0o600)
 				if err != nil {
 					return err
@@ -298,7 +411,7 @@ func (a *Attack) executeStep(ctx context.Context, r runner.Runner, step *recipe.
 					return err
 				}
 
-				a.Evidence["file:"+ev.Name] = dst
+				a.setEvidence("file:"+ev.Name+it.suffix(), dst)
 			}
 		case recipe.EvidenceTypeOutput:
 			r, err := regexp.Compile(ev.Regexp)
@@ -306,23 +419,49 @@ func (a *Attack) executeStep(ctx context.Context, r runner.Runner, step *recipe.
 				return err
 			}
 
-			var s bytes.Buffer
-			for i, m := range r.FindAll(buf.Bytes(), -1) {
-				if i > 0 {
-					s.WriteByte('\n')
-				}
-				s.Write(m)
-			}
-
-			if s.Len() == 0 {
+			m := findAll(r, buf.Bytes())
+			if len(m) == 0 {
 				return fmt.Errorf("evidence regexp '%s' did not match any output", ev.Regexp)
 			}
 
-			a.Evidence[ev.Name] = s.String()
+			a.setEvidence(ev.Name+it.suffix(), m)
+		}
+	}
+
+	return collectOutputs(ctx, r, step, res, buf.Bytes())
+}
+
+// whenEnv returns environment to evaluate step conditions in.
+func (a *Attack) whenEnv(params map[string]string, failed bool) *recipe.WhenEnv {
+	env := &recipe.WhenEnv{
+		Status:   recipe.StepStatusSuccess,
+		Failed:   failed,
+		Params:   params,
+		Evidence: make(map[string]string, len(a.Evidence)),
+		Steps:    a.steps,
+	}
+
+	if failed {
+		env.Status = recipe.StepStatusFailure
+	}
+
+	for k, v := range a.Evidence {
+		if strings.HasPrefix(k, "file:") {
+			continue
 		}
+
+		env.Evidence[k] = v
 	}
 
-	return nil
+	return env
+}
+
+// isStepFailure returns true if error is a step failure that should not abort the attack.
+func isStepFailure(err error) bool {
+	var e *ErrCommandFailed
+	var oom *ErrOutOfMemory
+
+	return errors.As(err, &e) || errors.As(err, &oom)
 }
 
 func (a *Attack) Execute(ctx context.Context) error {
@@ -332,24 +471,34 @@ func (a *Attack) Execute(ctx context.Context) error {
 
 	r := docker.New()
 
-	workspaceDir, err := a.prepareWorkspace(ctx, r)
+	workspaceDir, err := a.prepareWorkspace(ctx, r, params)
 	if err != nil {
 		return err
 	}
 	defer os.RemoveAll(workspaceDir)
 
+	a.workspaceDir = workspaceDir
+
 	evidenceDir, err := a.prepareEvidenceStore(ctx, r)
 	if err != nil {
 		return err
 	}
 	defer os.RemoveAll(evidenceDir)
 
-	services, prms, err := a.startServices(ctx)
+	removeNetwork, err := a.createNetwork(ctx)
+	if err != nil {
+		return err
+	}
+	defer removeNetwork()
+
+	services, prms, err := a.startServices(ctx, params)
 	if err != nil {
 		return err
 	}
 	defer a.stopServices(ctx, services)
 
+	a.services = services
+
 	for k, v := range prms {
 		// Do not overwrite existing parameters.
 		_, ok := params[k]
@@ -365,9 +514,24 @@ func (a *Attack) Execute(ctx context.Context) error {
 	var failed bool
 	var failErr error
 
+	a.steps = make(map[string]*recipe.StepResult, len(a.Recipe.Steps))
+	for _, step := range a.Recipe.Steps {
+		a.steps[step.Ref()] = &recipe.StepResult{Status: recipe.StepStatusPending}
+	}
+
 	for _, step := range a.Recipe.Steps {
-		if (failed && (step.When == nil || step.When.Status != "failure")) ||
-			(!failed && step.When != nil && step.When.Status != "success") {
+		if err := a.collectServiceEvidence(services); err != nil {
+			return err
+		}
+
+		ok, err := step.When.Match(a.whenEnv(params, failed))
+		if err != nil {
+			return fmt.Errorf("step '%s' condition: %w", step.Name, err)
+		}
+
+		if !ok {
+			a.steps[step.Ref()].Status = recipe.StepStatusSkipped
+
 			continue
 		}
 
@@ -385,9 +549,22 @@ func (a *Attack) Execute(ctx context.Context) error {
 			prms["evidence_"+k] = v
 		}
 
-		if err := a.executeStep(ctx, r, step, evidenceDir, prms); err != nil {
-			var e *ErrCommandFailed
-			if errors.As(err, &e) {
+		// Add outputs of previous steps.
+		for name, res := range a.steps {
+			for k, v := range res.Outputs {
+				prms[recipe.OutputParam(name, k)] = v
+			}
+		}
+
+		if step.Loop() != nil {
+			err = a.executeLoop(ctx, step, evidenceDir, prms)
+		} else {
+			err = a.executeStep(ctx, r, step, nil, a.steps[step.Ref()], evidenceDir, prms)
+		}
+
+		if err != nil {
+			if isStepFailure(err) {
+				a.steps[step.Ref()].Status = recipe.StepStatusFailure
 				failErr = err
 				failed = true
 
@@ -396,6 +573,8 @@ func (a *Attack) Execute(ctx context.Context) error {
 
 			return err
 		}
+
+		a.steps[step.Ref()].Status = recipe.StepStatusSuccess
 	}
 
 	// TODO: Archive evidence files and parameters to evidence directory
@@ -0,0 +1,134 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package executor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"vilks.io/vilks/recipe"
+	"vilks.io/vilks/runner"
+)
+
+// stdin returns command input.
+func (a *Attack) stdin(in *recipe.Stdin, params map[string]string) (io.ReadCloser, error) {
+	switch {
+	case in == nil:
+		return nil, nil
+	case in.FromFile != "":
+		if !filepath.IsLocal(in.FromFile) {
+			return nil, fmt.Errorf("stdin file '%s' must be relative path in workspace", in.FromFile)
+		}
+
+		return os.Open(filepath.Join(a.workspaceDir, in.FromFile))
+	case in.FromParam != "":
+		v, ok := params[in.FromParam]
+		if !ok {
+			return nil, fmt.Errorf("stdin parameter '%s' is not defined", in.FromParam)
+		}
+
+		return io.NopCloser(strings.NewReader(v)), nil
+	default:
+		data, err := a.expand(in.Data, params)
+		if err != nil {
+			return nil, err
+		}
+
+		return io.NopCloser(strings.NewReader(data)), nil
+	}
+}
+
+// execCommand executes step command showing its output live while also
+// collecting it to the result.
+func (a *Attack) execCommand(ctx context.Context, r runner.Runner, step *recipe.Step, it *iteration, c *recipe.Command, cmd string, params map[string]string) (*runner.ExecResult, error) {
+	var stdout, stderr bytes.Buffer
+
+	stdin, err := a.stdin(c.Stdin, params)
+	if err != nil {
+		return nil, err
+	}
+
+	if stdin != nil {
+		defer stdin.Close()
+	}
+
+	live := a.executor.log.Stream(a.executor.TeamName + "/" + step.Name + it.suffix())
+	defer live.Close()
+
+	env, err := step.Environ(params)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := runner.ExecOptions{
+		Env:    env,
+		Cmd:    []string{"/bin/sh", "-c", cmd},
+		Stdin:  stdin,
+		Stdout: io.MultiWriter(&stdout, live),
+		Stderr: io.MultiWriter(&stderr, live),
+		TTY:    c.TTY,
+	}
+
+	out, err := r.ExecStream(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	out.Stdout = stdout.Bytes()
+	out.Stderr = stderr.Bytes()
+
+	return out, nil
+}
+
+// checkCommand checks command exit code and output conditions. Command
+// conditions take precedence over step conditions.
+func checkCommand(c *recipe.Command, conditions *recipe.Conditions, out *runner.ExecResult) error {
+	if !slices.Contains(c.ExitCodes(), out.ExitCode) {
+		output := out.Stderr
+		if len(output) == 0 {
+			output = out.Stdout
+		}
+
+		return &ErrCommandFailed{Output: output}
+	}
+
+	if c.Conditions != nil {
+		conditions = c.Conditions
+	}
+
+	if conditions == nil {
+		return nil
+	}
+
+	if conditions.SuccessRegexp != "" {
+		r, err := regexp.Compile(conditions.SuccessRegexp)
+		if err != nil {
+			return err
+		}
+
+		if !r.Match(out.Stdout) {
+			return &ErrCommandFailed{Output: []byte(fmt.Sprintf("output did not match success regexp '%s'", conditions.SuccessRegexp))}
+		}
+	}
+
+	if conditions.FailureRegexp != "" {
+		r, err := regexp.Compile(conditions.FailureRegexp)
+		if err != nil {
+			return err
+		}
+
+		if r.Match(out.Stdout) {
+			return &ErrCommandFailed{Output: []byte(fmt.Sprintf("output matched failure regexp '%s'", conditions.FailureRegexp))}
+		}
+	}
+
+	return nil
+}
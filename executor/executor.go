@@ -10,6 +10,8 @@ import (
 	"vilks.io/vilks/evidence"
 	"vilks.io/vilks/logger"
 	"vilks.io/vilks/recipe"
+	"vilks.io/vilks/runner"
+	"vilks.io/vilks/secret"
 )
 
 type Executor struct {
@@ -18,6 +20,8 @@ type Executor struct {
 	log     logger.Logger
 	ev      evidence.Evidence
 
+	RunID        string
+	HostName     string
 	AttackName   string
 	AttackerHost string
 	TeamName     string
@@ -25,6 +29,27 @@ type Executor struct {
 	TeamParams   map[string]string
 
 	GlobalParams map[string]string
+
+	// HostParams are the target host parameters, exposed to recipes with "host_" prefix.
+	HostParams map[string]string
+
+	// Network is the name of existing network to connect attack containers to.
+	Network string
+	// NetworkAddress is the static IP address of step containers in the network.
+	NetworkAddress string
+
+	// RestrictEgress is a flag indicating if step and service containers can connect only to destinations allowed by Egress rules.
+	RestrictEgress bool
+	Egress         []runner.EgressRule
+
+	// Resources is the default resource limits of step and service containers.
+	Resources *recipe.Resources
+
+	// Ports is the port allocator shared between executors running in parallel.
+	Ports *PortAllocator
+
+	// Secrets masks secret values in logs and evidence.
+	Secrets *secret.Masker
 }
 
 func New(log logger.Logger, ev evidence.Evidence, recipes *recipe.Recipes) *Executor {
@@ -35,6 +60,14 @@ func New(log logger.Logger, ev evidence.Evidence, recipes *recipe.Recipes) *Exec
 	}
 }
 
+func (e *Executor) portAllocator() *PortAllocator {
+	if e.Ports == nil {
+		return defaultPorts
+	}
+
+	return e.Ports
+}
+
 func (e *Executor) AddAttack(host, recipe string, params map[string]string) error {
 	r := e.recipes.Get(recipe)
 	if r == nil {
@@ -66,6 +99,22 @@ func (e *Executor) Validate(_ context.Context) error {
 }
 
 func (e *Executor) Execute(ctx context.Context) error {
+	if e.Secrets == nil {
+		e.Secrets = secret.NewMasker()
+	}
+
+	for _, a := range e.attacks {
+		values := a.Values()
+		for _, p := range a.Recipe.Params {
+			if p.Type == recipe.ParamTypeSecret {
+				e.Secrets.Add(values[p.Name])
+			}
+		}
+	}
+
+	e.log = logger.Masked(e.log, e.Secrets)
+	e.ev = evidence.Masked(e.ev, e.Secrets)
+
 	for _, a := range e.attacks {
 		e.log.Info(fmt.Sprintf("Executing recipe '%s' on host '%s'", e.log.Special(a.Recipe.Name), e.log.Special(a.Host)), a.Values())
 
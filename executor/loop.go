@@ -0,0 +1,250 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package executor
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"vilks.io/vilks/recipe"
+	"vilks.io/vilks/runner"
+	"vilks.io/vilks/runner/docker"
+	"vilks.io/vilks/template"
+)
+
+// iteration is a single execution of looping step.
+type iteration struct {
+	index  int
+	params map[string]string
+}
+
+// suffix returns suffix for evidence names of the iteration.
+func (it *iteration) suffix() string {
+	if it == nil {
+		return ""
+	}
+
+	return "_" + strconv.Itoa(it.index)
+}
+
+// expandItems substitutes parameters in items and splits multi-line values
+// into separate items skipping empty lines.
+func expandItems(items []string, params map[string]string) ([]string, error) {
+	values := make([]string, 0, len(items))
+
+	for _, item := range items {
+		v, err := template.Expand(item, params)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, line := range strings.Split(v, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				values = append(values, line)
+			}
+		}
+	}
+
+	return values, nil
+}
+
+// iterations returns iterations of foreach or matrix step.
+func iterations(step *recipe.Step, params map[string]string) ([]*iteration, error) {
+	combinations := []map[string]string{{}}
+
+	if step.Foreach != nil {
+		values, err := expandItems(step.Foreach.Items, params)
+		if err != nil {
+			return nil, err
+		}
+
+		combinations = make([]map[string]string, 0, len(values))
+		for _, v := range values {
+			combinations = append(combinations, map[string]string{step.Foreach.ParamName(): v})
+		}
+	}
+
+	if step.Matrix != nil {
+		names := make([]string, 0, len(step.Matrix.Params))
+		for name := range step.Matrix.Params {
+			names = append(names, name)
+		}
+
+		slices.Sort(names)
+
+		for _, name := range names {
+			values, err := expandItems(step.Matrix.Params[name], params)
+			if err != nil {
+				return nil, err
+			}
+
+			next := make([]map[string]string, 0, len(combinations)*len(values))
+			for _, c := range combinations {
+				for _, v := range values {
+					m := maps.Clone(c)
+					m[name] = v
+					next = append(next, m)
+				}
+			}
+
+			combinations = next
+		}
+	}
+
+	its := make([]*iteration, 0, len(combinations))
+	for i, c := range combinations {
+		its = append(its, &iteration{index: i + 1, params: c})
+	}
+
+	return its, nil
+}
+
+// newRunner returns runner sharing attack workspace and evidence store.
+func (a *Attack) newRunner(ctx context.Context, evidenceDir string) (runner.Runner, error) {
+	r := docker.New()
+
+	if err := r.CreateWorkspace(ctx, a.workspaceDir); err != nil {
+		return nil, err
+	}
+
+	if err := r.CreateEvidenceStore(ctx, evidenceDir); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// executeLoop executes step for each of foreach items or matrix combinations.
+// Without stop on success step fails if any of iterations fails, otherwise
+// remaining iterations are stopped after first successful one and step fails
+// only if none of iterations succeed.
+func (a *Attack) executeLoop(ctx context.Context, step *recipe.Step, evidenceDir string, params map[string]string) error {
+	opts := step.Loop()
+
+	its, err := iterations(step, params)
+	if err != nil {
+		return err
+	}
+
+	concurrency := max(opts.Concurrency, 1)
+	if concurrency > 1 && a.executor.NetworkAddress != "" {
+		return fmt.Errorf("step '%s' can not run iterations concurrently with static network address", step.Name)
+	}
+
+	a.executor.log.Debug(fmt.Sprintf("Executing %d iterations of step %s with concurrency %d", len(its), a.executor.log.Special(step.Name), concurrency))
+
+	loopCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		sem     = make(chan struct{}, concurrency)
+		success *iteration
+		failErr error
+		fatal   error
+	)
+
+	result := a.steps[step.Ref()]
+
+	for _, it := range its {
+		select {
+		case sem <- struct{}{}:
+		case <-loopCtx.Done():
+		}
+
+		if loopCtx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+
+		go func(it *iteration) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			res := &recipe.StepResult{}
+
+			r, err := a.newRunner(loopCtx, evidenceDir)
+			if err == nil {
+				prms := maps.Clone(params)
+				maps.Copy(prms, it.params)
+
+				err = a.executeStep(loopCtx, r, step, it, res, evidenceDir, prms)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			switch {
+			case success != nil:
+				// Iteration was stopped after other iteration succeeded.
+				return
+			case err == nil:
+				result.ExitCode, result.Outputs = res.ExitCode, res.Outputs
+
+				if opts.StopOnSuccess {
+					success = it
+					cancel()
+				}
+			case isStepFailure(err):
+				result.ExitCode, result.Outputs = res.ExitCode, res.Outputs
+
+				a.executor.log.Debug(fmt.Sprintf("Iteration %d of step %s failed: %s", it.index, a.executor.log.Special(step.Name), err.Error()))
+
+				if failErr == nil {
+					failErr = err
+				}
+			case fatal == nil:
+				fatal = err
+				cancel()
+			}
+		}(it)
+	}
+
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if success != nil {
+		a.executor.log.Info(fmt.Sprintf("Step %s succeeded with iteration %d", a.executor.log.Special(step.Name), success.index))
+
+		if opts.Capture != "" {
+			a.captureIteration(step, opts.Capture, success)
+		}
+
+		return nil
+	}
+
+	if fatal != nil {
+		return fatal
+	}
+
+	if opts.StopOnSuccess && len(its) > 0 {
+		return &ErrCommandFailed{Output: []byte(fmt.Sprintf("none of %d iterations of step '%s' succeeded", len(its), step.Name))}
+	}
+
+	return failErr
+}
+
+// captureIteration stores values of the iteration as evidence. Foreach item is
+// stored under capture name, matrix values as capture name with parameter suffix.
+func (a *Attack) captureIteration(step *recipe.Step, capture string, it *iteration) {
+	if step.Foreach != nil {
+		a.setEvidence(capture, it.params[step.Foreach.ParamName()])
+
+		return
+	}
+
+	for k, v := range it.params {
+		a.setEvidence(capture+"_"+k, v)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package executor
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"vilks.io/vilks/logger"
+	"vilks.io/vilks/recipe"
+)
+
+func TestIterations(t *testing.T) {
+	params := map[string]string{
+		"users": "admin\n\n root \n",
+		"port":  "8080",
+	}
+
+	tests := []struct {
+		name string
+		step *recipe.Step
+		want []map[string]string
+		err  bool
+	}{
+		{
+			name: "single",
+			step: &recipe.Step{Name: "scan"},
+			want: []map[string]string{{}},
+		},
+		{
+			name: "foreach",
+			step: &recipe.Step{Foreach: &recipe.Foreach{Items: []string{"${users}", "guest"}}},
+			want: []map[string]string{{"item": "admin"}, {"item": "root"}, {"item": "guest"}},
+		},
+		{
+			name: "foreach param",
+			step: &recipe.Step{Foreach: &recipe.Foreach{Param: "user", Items: []string{"admin"}}},
+			want: []map[string]string{{"user": "admin"}},
+		},
+		{
+			name: "foreach without items",
+			step: &recipe.Step{Foreach: &recipe.Foreach{Items: []string{" \n"}}},
+			want: []map[string]string{},
+		},
+		{
+			name: "matrix",
+			step: &recipe.Step{Matrix: &recipe.Matrix{Params: map[string][]string{
+				"user": {"${users}"},
+				"port": {"22", "${port}"},
+			}}},
+			want: []map[string]string{
+				{"port": "22", "user": "admin"},
+				{"port": "22", "user": "root"},
+				{"port": "8080", "user": "admin"},
+				{"port": "8080", "user": "root"},
+			},
+		},
+		{
+			name: "undefined parameter",
+			step: &recipe.Step{Foreach: &recipe.Foreach{Items: []string{"${hosts}"}}},
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			its, err := iterations(tt.step, params)
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make([]map[string]string, 0, len(its))
+			for i, it := range its {
+				if it.index != i+1 {
+					t.Errorf("iteration %d has index %d", i+1, it.index)
+				}
+
+				got = append(got, it.params)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("iterations = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIterationSuffix(t *testing.T) {
+	var it *iteration
+	if s := it.suffix(); s != "" {
+		t.Errorf("suffix = %q, want empty", s)
+	}
+
+	if s := (&iteration{index: 3}).suffix(); s != "_3" {
+		t.Errorf("suffix = %q, want _3", s)
+	}
+}
+
+func TestExecuteLoopStaticAddress(t *testing.T) {
+	a := &Attack{executor: &Executor{log: &logger.Console{}, NetworkAddress: "10.0.0.5"}}
+
+	step := &recipe.Step{
+		Name: "brute",
+		Foreach: &recipe.Foreach{
+			Items:       []string{"admin", "root"},
+			LoopOptions: recipe.LoopOptions{Concurrency: 2},
+		},
+	}
+
+	err := a.executeLoop(context.Background(), step, "", map[string]string{})
+	if err == nil || !strings.Contains(err.Error(), "can not run iterations concurrently with static network address") {
+		t.Errorf("error = %v, want static network address error", err)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package executor
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"vilks.io/vilks/recipe"
+	"vilks.io/vilks/runner"
+)
+
+// collectOutputs extracts step outputs from step output or files in step container.
+func collectOutputs(ctx context.Context, r runner.Runner, step *recipe.Step, res *recipe.StepResult, stdout []byte) error {
+	if len(step.Outputs) == 0 {
+		return nil
+	}
+
+	outputs := make(map[string]string, len(step.Outputs))
+
+	for _, o := range step.Outputs {
+		var err error
+
+		switch {
+		case o.Regexp != "":
+			err = regexpOutputs(outputs, o, stdout)
+		case o.JSON != "":
+			outputs[o.Name], err = jsonPath(stdout, o.JSON)
+		case o.File != "":
+			outputs[o.Name], err = readFile(ctx, r, o.File)
+		default:
+			err = errors.New("output has no source")
+		}
+
+		if err != nil {
+			return fmt.Errorf("step '%s' output: %w", step.Name, err)
+		}
+	}
+
+	res.Outputs = outputs
+
+	return nil
+}
+
+// regexpOutputs sets output for each named regexp group of the first match,
+// or single output with first group or whole match if output name is set.
+func regexpOutputs(outputs map[string]string, o recipe.Output, data []byte) error {
+	r, err := regexp.Compile(o.Regexp)
+	if err != nil {
+		return err
+	}
+
+	m := r.FindSubmatch(data)
+	if m == nil {
+		return fmt.Errorf("regexp '%s' did not match any output", o.Regexp)
+	}
+
+	if o.Name != "" {
+		v := m[0]
+		if len(m) > 1 {
+			v = m[1]
+		}
+
+		outputs[o.Name] = string(v)
+
+		return nil
+	}
+
+	for i, name := range r.SubexpNames() {
+		if i > 0 && name != "" {
+			outputs[name] = string(m[i])
+		}
+	}
+
+	return nil
+}
+
+// jsonPath returns value at dot separated path in JSON data. Strings are
+// returned as is, other values are returned JSON encoded.
+func jsonPath(data []byte, path string) (string, error) {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return "", fmt.Errorf("failed to parse output as JSON: %w", err)
+	}
+
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+
+	if path != "" {
+		for _, key := range strings.Split(path, ".") {
+			switch val := v.(type) {
+			case map[string]any:
+				var ok bool
+				if v, ok = val[key]; !ok {
+					return "", fmt.Errorf("JSON path '%s' not found", path)
+				}
+			case []any:
+				i, err := strconv.Atoi(key)
+				if err != nil || i < 0 || i >= len(val) {
+					return "", fmt.Errorf("JSON path '%s' not found", path)
+				}
+
+				v = val[i]
+			default:
+				return "", fmt.Errorf("JSON path '%s' not found", path)
+			}
+		}
+	}
+
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case nil:
+		return "", nil
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+
+		return string(b), nil
+	}
+}
+
+// readFile returns trimmed contents of the file in step container.
+func readFile(ctx context.Context, r runner.Runner, path string) (string, error) {
+	rc, err := r.DownlaodEvidence(ctx, path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file '%s': %w", path, err)
+	}
+	defer rc.Close()
+
+	tr := tar.NewReader(rc)
+
+	if _, err := tr.Next(); err != nil {
+		return "", fmt.Errorf("failed to read file '%s': %w", path, err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, tr); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(buf.String()), nil
+}
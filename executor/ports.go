@@ -5,23 +5,178 @@ package executor
 
 import (
 	"errors"
+	"fmt"
 	"net"
+	"slices"
+	"strconv"
+	"sync"
 )
 
-func assignFreePort() (int, error) {
-	a, err := net.ResolveTCPAddr("tcp", "localhost:0")
-	if err == nil {
-		var l *net.TCPListener
+var ErrNoFreePort = errors.New("free port can not be assigned")
 
-		if l, err = net.ListenTCP("tcp", a); err == nil {
-			defer l.Close()
+var defaultPorts = NewPortAllocator("", 0, 0)
 
-			addr, ok := l.Addr().(*net.TCPAddr)
-			if ok {
-				return addr.Port, nil
+// PortAllocator assigns host ports to services. Assigned ports stay reserved
+// until released so that services started in parallel never get the same port.
+type PortAllocator struct {
+	bind  string
+	start int
+	end   int
+
+	mu       sync.Mutex
+	next     int
+	reserved map[int][]string
+}
+
+// NewPortAllocator creates port allocator that assigns ports from start to end
+// (inclusive) on bind address by default. If range is not set ports are
+// assigned by the operating system.
+func NewPortAllocator(bind string, start, end int) *PortAllocator {
+	return &PortAllocator{
+		bind:     bind,
+		start:    start,
+		end:      end,
+		next:     start,
+		reserved: make(map[int][]string),
+	}
+}
+
+// Bind returns default bind address.
+func (p *PortAllocator) Bind() string {
+	return p.bind
+}
+
+// Allocate reserves port that is free for both TCP and UDP on bind address.
+// If port is not zero exactly that port is reserved.
+func (p *PortAllocator) Allocate(bind string, port int) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if port != 0 {
+		if port < 1 || port > 65535 {
+			return 0, fmt.Errorf("port %d is out of range 1-65535", port)
+		}
+
+		if !p.available(bind, port) {
+			return 0, fmt.Errorf("port %d on '%s' is already in use", port, bind)
+		}
+
+		p.reserve(bind, port)
+
+		return port, nil
+	}
+
+	if p.start == 0 || p.end == 0 {
+		for range 10 {
+			port, err := freePort(bind)
+			if err != nil {
+				return 0, err
 			}
+
+			if p.available(bind, port) {
+				p.reserve(bind, port)
+
+				return port, nil
+			}
+		}
+
+		return 0, ErrNoFreePort
+	}
+
+	for range p.end - p.start + 1 {
+		port := p.next
+
+		p.next++
+		if p.next > p.end {
+			p.next = p.start
+		}
+
+		if p.available(bind, port) {
+			p.reserve(bind, port)
+
+			return port, nil
+		}
+	}
+
+	return 0, ErrNoFreePort
+}
+
+// Release returns port to the pool.
+func (p *PortAllocator) Release(bind string, port int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	binds := p.reserved[port]
+	if i := slices.Index(binds, bind); i >= 0 {
+		binds = slices.Delete(binds, i, i+1)
+	}
+
+	if len(binds) == 0 {
+		delete(p.reserved, port)
+
+		return
+	}
+
+	p.reserved[port] = binds
+}
+
+func (p *PortAllocator) reserve(bind string, port int) {
+	p.reserved[port] = append(p.reserved[port], bind)
+}
+
+func (p *PortAllocator) available(bind string, port int) bool {
+	for _, b := range p.reserved[port] {
+		if bindConflict(b, bind) {
+			return false
 		}
 	}
 
-	return 0, errors.New("free port can not be assigned")
+	addr := net.JoinHostPort(bind, strconv.Itoa(port))
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return false
+	}
+
+	_ = l.Close()
+
+	c, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return false
+	}
+
+	_ = c.Close()
+
+	return true
+}
+
+// bindConflict checks if the same port can not be bound on both addresses,
+// unspecified address conflicts with every other address.
+func bindConflict(a, b string) bool {
+	return a == b || isUnspecified(a) || isUnspecified(b)
+}
+
+func isUnspecified(bind string) bool {
+	if bind == "" {
+		return true
+	}
+
+	ip := net.ParseIP(bind)
+
+	return ip != nil && ip.IsUnspecified()
+}
+
+func freePort(bind string) (int, error) {
+	l, err := net.Listen("tcp", net.JoinHostPort(bind, "0"))
+	if err != nil {
+		return 0, ErrNoFreePort
+	}
+	defer l.Close()
+
+	addr, ok := l.Addr().(*net.TCPAddr)
+	if !ok {
+		return 0, ErrNoFreePort
+	}
+
+	return addr.Port, nil
 }
@@ -0,0 +1,191 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package executor
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+
+	"vilks.io/vilks/logger"
+	"vilks.io/vilks/recipe"
+)
+
+const localhost = "127.0.0.1"
+
+func testPort(t *testing.T) int {
+	t.Helper()
+
+	port, err := freePort(localhost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return port
+}
+
+func TestPortAllocatorReserve(t *testing.T) {
+	port := testPort(t)
+
+	tests := []struct {
+		name     string
+		reserved string
+		bind     string
+		ok       bool
+	}{
+		{name: "same address", reserved: localhost, bind: localhost},
+		{name: "unspecified reserved", reserved: "", bind: localhost},
+		{name: "unspecified requested", reserved: localhost, bind: "0.0.0.0"},
+		{name: "other address", reserved: localhost, bind: "127.0.0.2", ok: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPortAllocator("", 0, 0)
+
+			if _, err := p.Allocate(tt.reserved, port); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := p.Allocate(tt.bind, port)
+			if tt.ok != (err == nil) {
+				t.Fatalf("error = %v, want ok %t", err, tt.ok)
+			}
+
+			p.Release(tt.reserved, port)
+
+			if _, err := p.Allocate(tt.bind, port); !tt.ok && err != nil {
+				t.Errorf("port not released: %v", err)
+			}
+		})
+	}
+}
+
+func TestPortAllocatorProbe(t *testing.T) {
+	p := NewPortAllocator(localhost, 0, 0)
+
+	l, err := net.Listen("tcp", net.JoinHostPort(localhost, "0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	tcp := l.Addr().(*net.TCPAddr).Port
+	if _, err := p.Allocate(localhost, tcp); err == nil {
+		t.Errorf("port %d used by TCP listener was allocated", tcp)
+	}
+
+	c, err := net.ListenPacket("udp", net.JoinHostPort(localhost, "0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	udp := c.LocalAddr().(*net.UDPAddr).Port
+	if _, err := p.Allocate(localhost, udp); err == nil {
+		t.Errorf("port %d used by UDP listener was allocated", udp)
+	}
+
+	for _, port := range []int{-1, 65536} {
+		if _, err := p.Allocate(localhost, port); err == nil {
+			t.Errorf("port %d out of range was allocated", port)
+		}
+	}
+
+	port, err := p.Allocate(localhost, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if port == tcp || port == udp {
+		t.Errorf("allocated port %d is in use", port)
+	}
+}
+
+func TestPortAllocatorRange(t *testing.T) {
+	start := testPort(t)
+	p := NewPortAllocator(localhost, start, start)
+
+	port, err := p.Allocate(localhost, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if port != start {
+		t.Errorf("port = %d, want %d", port, start)
+	}
+
+	if _, err := p.Allocate(localhost, 0); !errors.Is(err, ErrNoFreePort) {
+		t.Errorf("error = %v, want %v", err, ErrNoFreePort)
+	}
+
+	p.Release(localhost, port)
+
+	if port, err = p.Allocate(localhost, 0); err != nil || port != start {
+		t.Errorf("port = %d (%v), want released %d", port, err, start)
+	}
+}
+
+func TestAllocatePorts(t *testing.T) {
+	tests := []struct {
+		name  string
+		ports []recipe.ServicePort
+		keys  []portKey
+		err   bool
+	}{
+		{
+			name: "tcp and udp",
+			ports: []recipe.ServicePort{
+				{Name: "dns_tcp", Port: "53"},
+				{Name: "dns_udp", Port: "53/udp"},
+			},
+			keys: []portKey{{"dns", "53", "tcp"}, {"dns", "53", "udp"}},
+		},
+		{
+			name: "same port twice",
+			ports: []recipe.ServicePort{
+				{Name: "http", Port: "80"},
+				{Name: "web", Port: "80/TCP"},
+			},
+			err: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Attack{executor: &Executor{log: &logger.Console{}, Ports: NewPortAllocator(localhost, 0, 0)}}
+			s := &service{svc: &recipe.Service{Name: "dns", Ports: tt.ports}}
+			params := make(map[string]string)
+
+			hostPorts, err := a.allocatePorts(s, params)
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(hostPorts) != len(tt.keys) {
+				t.Fatalf("host ports = %v, want %v", hostPorts, tt.keys)
+			}
+
+			for i, k := range tt.keys {
+				hp, ok := hostPorts[k]
+				if !ok {
+					t.Fatalf("port %s not published", k)
+				}
+
+				if params[tt.ports[i].Name] != strconv.Itoa(hp.port) {
+					t.Errorf("parameter %s = %s, want %d", tt.ports[i].Name, params[tt.ports[i].Name], hp.port)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package executor
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"vilks.io/vilks/recipe"
+	"vilks.io/vilks/runner"
+)
+
+func (a *Attack) waitServiceReady(ctx context.Context, r runner.Runner, svc *recipe.Service, hostPorts map[portKey]hostPort) error {
+	for _, check := range svc.Readiness {
+		a.executor.log.Debug(fmt.Sprintf("Waiting for service %s %s check", a.executor.log.Special(svc.Name), check.Type))
+
+		if err := waitReady(ctx, r, svc, check, hostPorts); err != nil {
+			return fmt.Errorf("service '%s' did not become ready: %w", svc.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func waitReady(ctx context.Context, r runner.Runner, svc *recipe.Service, check recipe.Readiness, hostPorts map[portKey]hostPort) error {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = recipe.DefaultReadinessTimeout
+	}
+
+	interval := check.Interval
+	if interval <= 0 {
+		interval = recipe.DefaultReadinessInterval
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var probe func(ctx context.Context) error
+
+	switch check.Type {
+	case recipe.ReadinessTypeTCP, recipe.ReadinessTypeHTTP:
+		p := svc.Port(check.Port)
+		if p == nil {
+			return fmt.Errorf("%s check port '%s' is not defined", check.Type, check.Port)
+		}
+
+		hp, ok := hostPorts[newPortKey(svc.Name, p.Port)]
+		if !ok {
+			return fmt.Errorf("%s check port '%s' is not published", check.Type, check.Port)
+		}
+
+		addr := hp.addr()
+
+		if check.Type == recipe.ReadinessTypeTCP {
+			probe = func(ctx context.Context) error {
+				return probeTCP(ctx, addr)
+			}
+		} else {
+			url := "http://" + addr + "/" + strings.TrimPrefix(check.Path, "/")
+			probe = func(ctx context.Context) error {
+				return probeHTTP(ctx, url)
+			}
+		}
+	case recipe.ReadinessTypeLog:
+		re, err := regexp.Compile(check.Regexp)
+		if err != nil {
+			return err
+		}
+
+		if err := waitLog(ctx, r, re); err != nil {
+			return fmt.Errorf("log check did not match '%s' in %s: %w", check.Regexp, timeout, err)
+		}
+
+		return nil
+	case recipe.ReadinessTypeExec:
+		probe = func(ctx context.Context) error {
+			return probeExec(ctx, r, check.Command)
+		}
+	default:
+		return fmt.Errorf("unsupported readiness check type '%s'", check.Type)
+	}
+
+	for {
+		err := probe(ctx)
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s check did not pass in %s: %w", check.Type, timeout, err)
+		case <-time.After(interval):
+		}
+	}
+}
+
+func probeTCP(ctx context.Context, addr string) error {
+	var d net.Dialer
+
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Docker userland proxy accepts connections even if nothing is listening
+	// in the container and closes them right away.
+	_ = conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, err := conn.Read(make([]byte, 1)); errors.Is(err, io.EOF) {
+		return errors.New("connection closed by remote")
+	}
+
+	return nil
+}
+
+func probeHTTP(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected HTTP status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func probeExec(ctx context.Context, r runner.Runner, cmd string) error {
+	out, err := r.Exec(ctx, nil, "/bin/sh", "-c", cmd)
+	if err != nil {
+		return err
+	}
+
+	if out.ExitCode != 0 {
+		return fmt.Errorf("command exited with code %d", out.ExitCode)
+	}
+
+	return nil
+}
+
+func waitLog(ctx context.Context, r runner.Runner, re *regexp.Regexp) error {
+	rc, err := r.Tail(ctx)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	found := make(chan error, 1)
+
+	go func() {
+		s := bufio.NewScanner(rc)
+		for s.Scan() {
+			if re.Match(s.Bytes()) {
+				found <- nil
+
+				return
+			}
+		}
+
+		if err := s.Err(); err != nil {
+			found <- err
+
+			return
+		}
+
+		found <- errors.New("service exited")
+	}()
+
+	select {
+	case err := <-found:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package executor
+
+import (
+	"fmt"
+	"math"
+
+	"vilks.io/vilks/recipe"
+	"vilks.io/vilks/runner"
+
+	"github.com/docker/go-units"
+)
+
+// resources returns container resource limits with scenario defaults applied.
+func (a *Attack) resources(res *recipe.Resources) (*runner.Resources, error) {
+	res = res.WithDefaults(a.executor.Resources)
+	if res == nil {
+		return nil, nil
+	}
+
+	r := &runner.Resources{
+		NanoCPUs:  int64(math.Round(res.CPUs * 1e9)),
+		PidsLimit: res.PidsLimit,
+	}
+
+	if res.Memory != "" {
+		mem, err := units.RAMInBytes(res.Memory)
+		if err != nil {
+			return nil, fmt.Errorf("invalid memory limit '%s': %w", res.Memory, err)
+		}
+
+		r.Memory = mem
+	}
+
+	for name, val := range res.Ulimits {
+		u, err := units.ParseUlimit(name + "=" + val)
+		if err != nil {
+			return nil, err
+		}
+
+		r.Ulimits = append(r.Ulimits, runner.Ulimit{
+			Name: u.Name,
+			Soft: u.Soft,
+			Hard: u.Hard,
+		})
+	}
+
+	return r, nil
+}
@@ -0,0 +1,527 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package executor
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"vilks.io/vilks/listener"
+	"vilks.io/vilks/recipe"
+	"vilks.io/vilks/runner"
+	"vilks.io/vilks/runner/docker"
+)
+
+type hostPort struct {
+	bind string
+	port int
+}
+
+// portKey identifies published container port of a service.
+type portKey struct {
+	service string
+	port    string
+	proto   string
+}
+
+// newPortKey returns key of service container port given in form port[/protocol],
+// protocol defaults to tcp.
+func newPortKey(service, port string) portKey {
+	num, proto, _ := strings.Cut(port, "/")
+	if proto == "" {
+		proto = "tcp"
+	}
+
+	return portKey{service: service, port: num, proto: strings.ToLower(proto)}
+}
+
+// String returns container port in form port/protocol.
+func (k portKey) String() string {
+	return k.port + "/" + k.proto
+}
+
+// addr returns address to connect to the port from the local host.
+func (p hostPort) addr() string {
+	host := p.bind
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(p.port))
+}
+
+// maxServiceLogs is the maximum size of the latest service output kept in
+// memory for wait and evidence matching, full output is streamed to evidence.
+const maxServiceLogs = 1 << 20
+
+type service struct {
+	runner   runner.Runner
+	listener listener.Listener
+	svc      *recipe.Service
+	ports    []hostPort
+
+	mu        sync.Mutex
+	logs      []byte
+	written   int
+	output    io.WriteCloser
+	outputErr error
+	done      chan struct{}
+}
+
+func (s *service) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.output != nil {
+		if _, err := s.output.Write(p); err != nil {
+			_ = s.output.Close()
+			s.output, s.outputErr = nil, err
+		}
+	}
+
+	s.logs = append(s.logs, p...)
+	s.written += len(p)
+
+	if n := len(s.logs) - maxServiceLogs; n > 0 {
+		s.logs = append(s.logs[:0], s.logs[n:]...)
+	}
+
+	return len(p), nil
+}
+
+// Size returns total size of service output written so far.
+func (s *service) Size() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.written
+}
+
+// Logs returns service output kept in memory.
+func (s *service) Logs() []byte {
+	return s.LogsSince(0)
+}
+
+// LogsSince returns service output kept in memory written after offset.
+func (s *service) LogsSince(offset int) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	start := max(offset-(s.written-len(s.logs)), 0)
+	if start >= len(s.logs) {
+		return nil
+	}
+
+	return bytes.Clone(s.logs[start:])
+}
+
+// closeOutput closes service output evidence stream.
+func (s *service) closeOutput() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.output != nil {
+		if err := s.output.Close(); err != nil && s.outputErr == nil {
+			s.outputErr = err
+		}
+
+		s.output = nil
+	}
+
+	return s.outputErr
+}
+
+func (s *service) collectLogs(ctx context.Context) error {
+	rc, err := s.runner.Tail(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+		defer rc.Close()
+
+		_, _ = io.Copy(s, rc)
+	}()
+
+	return nil
+}
+
+func (s *service) stop(ctx context.Context) {
+	if s.listener != nil {
+		_ = s.listener.Close()
+	}
+
+	if s.runner != nil {
+		_ = s.runner.Stop(ctx)
+	}
+
+	if s.done != nil {
+		<-s.done
+	}
+}
+
+func (a *Attack) startServices(ctx context.Context, attackParams map[string]string) ([]*service, map[string]string, error) {
+	services := make([]*service, 0, len(a.Recipe.Services))
+	params := make(map[string]string, len(a.Recipe.Services))
+
+	for _, svc := range a.Recipe.Services {
+		a.executor.log.Info("Starting service " + a.executor.log.Special(svc.Name))
+
+		s := &service{
+			svc: svc,
+		}
+		services = append(services, s)
+
+		output, err := a.executor.ev.Stream(svc.Name+"_service_output", "text/plain")
+		if err != nil {
+			a.stopServices(ctx, services)
+
+			return nil, nil, fmt.Errorf("service '%s' output: %w", svc.Name, err)
+		}
+
+		s.output = output
+
+		hostPorts, err := a.allocatePorts(s, params)
+		if err != nil {
+			a.stopServices(ctx, services)
+
+			return nil, nil, err
+		}
+
+		switch svc.Kind() {
+		case recipe.ServiceTypeContainer:
+			err = a.startContainerService(ctx, s, hostPorts, serviceParams(attackParams, params))
+		case recipe.ServiceTypeListener, recipe.ServiceTypeHTTPListener, recipe.ServiceTypeDNSListener:
+			err = a.startListenerService(s, hostPorts, params)
+		default:
+			err = fmt.Errorf("unsupported service type '%s'", svc.Type)
+		}
+
+		if err != nil {
+			a.stopServices(ctx, services)
+
+			return nil, nil, err
+		}
+	}
+
+	return services, params, nil
+}
+
+// serviceParams returns parameters to expand service command with, attack
+// parameters take precedence over parameters of services started so far.
+func serviceParams(attackParams, params map[string]string) map[string]string {
+	prms := maps.Clone(params)
+	maps.Copy(prms, attackParams)
+
+	return prms
+}
+
+// allocatePorts reserves host ports for service and sets port parameters.
+func (a *Attack) allocatePorts(s *service, params map[string]string) (map[portKey]hostPort, error) {
+	alloc := a.executor.portAllocator()
+	hostPorts := make(map[portKey]hostPort, len(s.svc.Ports))
+
+	for _, p := range s.svc.Ports {
+		key := newPortKey(s.svc.Name, p.Port)
+		if _, ok := hostPorts[key]; ok {
+			return nil, fmt.Errorf("service '%s' port '%s' publishes container port %s more than once", s.svc.Name, p.Name, key)
+		}
+
+		bind := p.Bind
+		if bind == "" {
+			bind = alloc.Bind()
+		}
+
+		var port int
+
+		if p.Base > 0 {
+			idx, err := strconv.Atoi(a.executor.TeamIndex)
+			if err != nil {
+				return nil, fmt.Errorf("service '%s' port '%s' requires numeric team index: %w", s.svc.Name, p.Name, err)
+			}
+
+			port = p.Base + idx
+		}
+
+		hp, err := alloc.Allocate(bind, port)
+		if err != nil {
+			return nil, fmt.Errorf("service '%s' port '%s': %w", s.svc.Name, p.Name, err)
+		}
+
+		a.executor.log.Debug(fmt.Sprintf("Assigning port %d to %s", hp, key))
+
+		s.ports = append(s.ports, hostPort{bind: bind, port: hp})
+		params[p.Name] = strconv.Itoa(hp)
+		hostPorts[key] = hostPort{bind: bind, port: hp}
+	}
+
+	return hostPorts, nil
+}
+
+func (a *Attack) startContainerService(ctx context.Context, s *service, hostPorts map[portKey]hostPort, params map[string]string) error {
+	command, err := a.expand(s.svc.Command, params)
+	if err != nil {
+		return fmt.Errorf("service '%s' command: %w", s.svc.Name, err)
+	}
+
+	ports := make([]string, 0, len(hostPorts))
+	for k, hp := range hostPorts {
+		p := k.String()
+		if hp.bind != "" {
+			ports = append(ports, fmt.Sprintf("%s:%d:%s", hp.bind, hp.port, p))
+		} else {
+			ports = append(ports, fmt.Sprintf("%d:%s", hp.port, p))
+		}
+	}
+
+	res, err := a.resources(s.svc.Resources)
+	if err != nil {
+		return err
+	}
+
+	r := docker.New()
+
+	if err := r.Start(ctx, runner.StartOptions{
+		Image:     s.svc.Image,
+		Service:   true,
+		Ports:     ports,
+		Labels:    a.labels(runner.LabelService, s.svc.Name),
+		Networks:  a.networks(s.svc),
+		Resources: res,
+
+		User:        s.svc.User,
+		CapAdd:      s.svc.CapAdd,
+		CapDrop:     s.svc.CapDrop,
+		Privileged:  s.svc.Privileged,
+		ReadOnly:    s.svc.ReadOnly,
+		SecurityOpt: s.svc.SecurityOpt,
+		Entrypoint:  []string{"/bin/sh", "-c", command},
+
+		RestrictEgress: a.executor.RestrictEgress,
+		Egress:         a.egress(),
+	}); err != nil {
+		return err
+	}
+
+	s.runner = r
+
+	if err := s.collectLogs(ctx); err != nil {
+		return err
+	}
+
+	return a.waitServiceReady(ctx, r, s.svc, hostPorts)
+}
+
+func (a *Attack) startListenerService(s *service, hostPorts map[portKey]hostPort, params map[string]string) error {
+	if len(s.svc.Readiness) > 0 {
+		return fmt.Errorf("service '%s' readiness checks are supported only for container services", s.svc.Name)
+	}
+
+	if len(hostPorts) != 1 {
+		return fmt.Errorf("service '%s' must have exactly one port", s.svc.Name)
+	}
+
+	var hp hostPort
+	for _, p := range hostPorts {
+		hp = p
+	}
+
+	var l listener.Listener
+
+	switch s.svc.Kind() {
+	case recipe.ServiceTypeHTTPListener:
+		if s.svc.Token == "" {
+			return fmt.Errorf("service '%s' must have token parameter name", s.svc.Name)
+		}
+
+		token, err := newToken()
+		if err != nil {
+			return err
+		}
+
+		params[s.svc.Token] = token
+		params[s.svc.Token+"_url"] = fmt.Sprintf("http://%s/%s", net.JoinHostPort(a.executor.AttackerHost, strconv.Itoa(hp.port)), token)
+
+		l = listener.NewHTTP(s.svc.Token, token, s)
+	case recipe.ServiceTypeDNSListener:
+		if s.svc.Token == "" || s.svc.Domain == "" {
+			return fmt.Errorf("service '%s' must have token parameter name and domain", s.svc.Name)
+		}
+
+		token, err := newToken()
+		if err != nil {
+			return err
+		}
+
+		params[s.svc.Token] = token
+		params[s.svc.Token+"_domain"] = token + "." + strings.TrimSuffix(s.svc.Domain, ".")
+
+		l = listener.NewDNS(s.svc.Token, s.svc.Domain, token, net.ParseIP(a.executor.AttackerHost), s)
+	default:
+		l = listener.NewShell(s.svc.Script, s)
+	}
+
+	if err := l.Listen(net.JoinHostPort(hp.bind, strconv.Itoa(hp.port))); err != nil {
+		return err
+	}
+
+	s.listener = l
+
+	return nil
+}
+
+func (a *Attack) service(name string) *service {
+	for _, s := range a.services {
+		if s.svc.Name == name {
+			return s
+		}
+	}
+
+	return nil
+}
+
+// waitService waits for service output after offset to match regexp.
+func (a *Attack) waitService(ctx context.Context, wait *recipe.Wait, params map[string]string, offset int) error {
+	s := a.service(wait.Service)
+	if s == nil {
+		return fmt.Errorf("unknown service '%s'", wait.Service)
+	}
+
+	expr, err := a.expand(wait.Regexp, params)
+	if err != nil {
+		return err
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return err
+	}
+
+	timeout := wait.Timeout
+	if timeout <= 0 {
+		timeout = recipe.DefaultWaitTimeout
+	}
+
+	a.executor.log.Debug(fmt.Sprintf("Waiting up to %s for service %s output to match '%s'", timeout, a.executor.log.Special(wait.Service), expr))
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if logs := s.LogsSince(offset); len(logs) > 0 && re.Match(logs) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return &ErrCommandFailed{Output: []byte(fmt.Sprintf("service '%s' output did not match '%s' in %s", wait.Service, expr, timeout))}
+			}
+
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// collectServiceEvidence matches service evidence rules over service output collected so far.
+func (a *Attack) collectServiceEvidence(services []*service) error {
+	for _, s := range services {
+		if s.listener != nil {
+			for k, v := range s.listener.Values() {
+				a.Evidence[k] = v
+			}
+		}
+
+		var logs []byte
+
+		for _, ev := range s.svc.Evidence {
+			if ev.Type != "" && ev.Type != recipe.EvidenceTypeOutput {
+				return fmt.Errorf("service '%s' evidence '%s' has unsupported type '%s'", s.svc.Name, ev.Name, ev.Type)
+			}
+
+			r, err := regexp.Compile(ev.Regexp)
+			if err != nil {
+				return err
+			}
+
+			if logs == nil {
+				logs = s.Logs()
+			}
+
+			if m := findAll(r, logs); len(m) > 0 {
+				a.Evidence[ev.Name] = m
+			}
+		}
+	}
+
+	return nil
+}
+
+func (a *Attack) stopServices(ctx context.Context, services []*service) {
+	// Clean up even if attack was aborted.
+	ctx = context.WithoutCancel(ctx)
+
+	for _, s := range services {
+		s.stop(ctx)
+
+		for _, p := range s.ports {
+			a.executor.portAllocator().Release(p.bind, p.port)
+		}
+	}
+
+	if err := a.collectServiceEvidence(services); err != nil {
+		a.executor.log.Error(err.Error())
+	}
+
+	for _, s := range services {
+		a.executor.log.Console(fmt.Sprintf("Service %s output", s.svc.Name), s.Logs())
+
+		if err := s.closeOutput(); err != nil {
+			a.executor.log.Error(fmt.Sprintf("Failed to store service '%s' output: %s", s.svc.Name, err.Error()))
+		}
+	}
+}
+
+// findAll returns all regexp matches in data joined by new line.
+func findAll(r *regexp.Regexp, data []byte) string {
+	var s bytes.Buffer
+
+	for i, m := range r.FindAll(data, -1) {
+		if i > 0 {
+			s.WriteByte('\n')
+		}
+
+		s.Write(m)
+	}
+
+	return s.String()
+}
@@ -0,0 +1,237 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package listener
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	dnsHeaderLen = 12
+
+	dnsTypeA   = 1
+	dnsClassIN = 1
+
+	dnsRcodeFormErr = 1
+	dnsRcodeRefused = 5
+)
+
+var errMalformedQuery = errors.New("malformed DNS query")
+
+var dnsTypes = map[uint16]string{
+	1:   "A",
+	2:   "NS",
+	5:   "CNAME",
+	6:   "SOA",
+	12:  "PTR",
+	15:  "MX",
+	16:  "TXT",
+	28:  "AAAA",
+	33:  "SRV",
+	255: "ANY",
+}
+
+// DNS is an authoritative DNS server for given domain that records every query.
+type DNS struct {
+	name   string
+	domain string
+	token  string
+	answer net.IP
+	out    io.Writer
+
+	mu      sync.Mutex
+	conn    net.PacketConn
+	queries int
+	matched int
+	done    chan struct{}
+}
+
+// NewDNS creates DNS callback listener for domain that answers A queries with
+// answer address and writes queries to out. Query counters are exposed as
+// values prefixed with name.
+func NewDNS(name, domain, token string, answer net.IP, out io.Writer) *DNS {
+	return &DNS{
+		name:   name,
+		domain: strings.ToLower(strings.TrimSuffix(domain, ".")),
+		token:  strings.ToLower(token),
+		answer: answer.To4(),
+		out:    out,
+	}
+}
+
+func (d *DNS) Listen(addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	d.conn = conn
+	d.done = make(chan struct{})
+
+	go d.serve()
+
+	return nil
+}
+
+func (d *DNS) serve() {
+	defer close(d.done)
+
+	buf := make([]byte, 512)
+
+	for {
+		n, addr, err := d.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		resp := d.handle(buf[:n], addr)
+		if resp != nil {
+			_, _ = d.conn.WriteTo(resp, addr)
+		}
+	}
+}
+
+func (d *DNS) handle(req []byte, addr net.Addr) []byte {
+	// Ignore responses.
+	if len(req) < dnsHeaderLen || req[2]&0x80 != 0 {
+		return nil
+	}
+
+	name, qtype, end, err := parseQuestion(req)
+	if err != nil {
+		return dnsResponse(req[:dnsHeaderLen], nil, dnsRcodeFormErr, nil)
+	}
+
+	inZone := name == d.domain || strings.HasSuffix(name, "."+d.domain)
+	matched := inZone && d.token != "" && strings.Contains(name, d.token)
+
+	typ, ok := dnsTypes[qtype]
+	if !ok {
+		typ = "TYPE" + strconv.Itoa(int(qtype))
+	}
+
+	d.mu.Lock()
+	d.queries++
+	if matched {
+		d.matched++
+	}
+
+	fmt.Fprintf(d.out, "=== query %d from %s token=%t\n%s. %s\n", d.queries, addr, matched, name, typ)
+	d.mu.Unlock()
+
+	if !inZone {
+		return dnsResponse(req[:dnsHeaderLen], req[dnsHeaderLen:end], dnsRcodeRefused, nil)
+	}
+
+	var answer []byte
+
+	if qtype == dnsTypeA && d.answer != nil {
+		answer = make([]byte, 0, 16)
+		// Pointer to the name in question section.
+		answer = append(answer, 0xc0, dnsHeaderLen)
+		answer = binary.BigEndian.AppendUint16(answer, dnsTypeA)
+		answer = binary.BigEndian.AppendUint16(answer, dnsClassIN)
+		answer = binary.BigEndian.AppendUint32(answer, 0)
+		answer = binary.BigEndian.AppendUint16(answer, uint16(len(d.answer)))
+		answer = append(answer, d.answer...)
+	}
+
+	return dnsResponse(req[:dnsHeaderLen], req[dnsHeaderLen:end], 0, answer)
+}
+
+// parseQuestion parses the first question of DNS query and returns queried
+// name, type and offset of the end of question.
+func parseQuestion(req []byte) (string, uint16, int, error) {
+	if binary.BigEndian.Uint16(req[4:6]) == 0 {
+		return "", 0, 0, errMalformedQuery
+	}
+
+	labels := make([]string, 0, 4)
+	off := dnsHeaderLen
+
+	for {
+		if off >= len(req) {
+			return "", 0, 0, errMalformedQuery
+		}
+
+		l := int(req[off])
+		off++
+
+		if l == 0 {
+			break
+		}
+
+		// Compression is not expected in question of a query.
+		if l&0xc0 != 0 || off+l > len(req) {
+			return "", 0, 0, errMalformedQuery
+		}
+
+		labels = append(labels, strings.ToLower(string(req[off:off+l])))
+		off += l
+	}
+
+	if off+4 > len(req) {
+		return "", 0, 0, errMalformedQuery
+	}
+
+	return strings.Join(labels, "."), binary.BigEndian.Uint16(req[off : off+2]), off + 4, nil
+}
+
+func dnsResponse(header, question []byte, rcode byte, answer []byte) []byte {
+	resp := make([]byte, dnsHeaderLen, dnsHeaderLen+len(question)+len(answer))
+	copy(resp, header)
+
+	// QR, opcode and RD from query, AA set.
+	resp[2] = 0x80 | header[2]&0x79 | 0x04
+	resp[3] = rcode
+
+	var qd, an uint16
+	if question != nil {
+		qd = 1
+	}
+
+	if answer != nil {
+		an = 1
+	}
+
+	binary.BigEndian.PutUint16(resp[4:6], qd)
+	binary.BigEndian.PutUint16(resp[6:8], an)
+	binary.BigEndian.PutUint16(resp[8:10], 0)
+	binary.BigEndian.PutUint16(resp[10:12], 0)
+
+	resp = append(resp, question...)
+
+	return append(resp, answer...)
+}
+
+func (d *DNS) Values() map[string]string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return map[string]string{
+		d.name + "_queries":         strconv.Itoa(d.queries),
+		d.name + "_matched_queries": strconv.Itoa(d.matched),
+	}
+}
+
+func (d *DNS) Close() error {
+	if d.conn == nil {
+		return nil
+	}
+
+	err := d.conn.Close()
+
+	<-d.done
+
+	return err
+}
+
+var _ Listener = &DNS{}
@@ -0,0 +1,189 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package listener
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dnsQuery builds DNS query with single question.
+func dnsQuery(id uint16, name string, qtype uint16) []byte {
+	q := binary.BigEndian.AppendUint16(nil, id)
+	// RD flag, one question.
+	q = append(q, 0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00)
+
+	for _, l := range strings.Split(name, ".") {
+		q = append(q, byte(len(l)))
+		q = append(q, l...)
+	}
+
+	q = append(q, 0)
+	q = binary.BigEndian.AppendUint16(q, qtype)
+
+	return binary.BigEndian.AppendUint16(q, dnsClassIN)
+}
+
+func TestParseQuestion(t *testing.T) {
+	tests := []struct {
+		name  string
+		req   []byte
+		qname string
+		qtype uint16
+		err   bool
+	}{
+		{name: "a", req: dnsQuery(1, "abc.Example.COM", dnsTypeA), qname: "abc.example.com", qtype: dnsTypeA},
+		{name: "txt", req: dnsQuery(1, "example.com", 16), qname: "example.com", qtype: 16},
+		{name: "no questions", req: make([]byte, dnsHeaderLen), err: true},
+		{name: "truncated name", req: dnsQuery(1, "example.com", dnsTypeA)[:dnsHeaderLen+5], err: true},
+		{name: "truncated type", req: dnsQuery(1, "example.com", dnsTypeA)[:dnsHeaderLen+14], err: true},
+		{name: "compressed name", req: append(dnsQuery(1, "x", dnsTypeA)[:dnsHeaderLen], 0xc0, 0x0c, 0, 1, 0, 1), err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, qtype, end, err := parseQuestion(tt.req)
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if name != tt.qname || qtype != tt.qtype || end != len(tt.req) {
+				t.Errorf("got %s %d end %d, want %s %d end %d", name, qtype, end, tt.qname, tt.qtype, len(tt.req))
+			}
+		})
+	}
+}
+
+func TestDNS(t *testing.T) {
+	const token = "a1b2c3d4"
+
+	tests := []struct {
+		name    string
+		req     []byte
+		rcode   byte
+		answer  net.IP
+		matched bool
+		output  string
+	}{
+		{
+			name:    "token a",
+			req:     dnsQuery(1, token+".cb.example.com", dnsTypeA),
+			answer:  net.IPv4(10, 0, 0, 1).To4(),
+			matched: true,
+			output:  token + ".cb.example.com. A\n",
+		},
+		{
+			name:    "token aaaa",
+			req:     dnsQuery(2, "x."+token+".CB.example.com", 28),
+			matched: true,
+			output:  "x." + token + ".cb.example.com. AAAA\n",
+		},
+		{
+			name:   "zone without token",
+			req:    dnsQuery(3, "cb.example.com", dnsTypeA),
+			answer: net.IPv4(10, 0, 0, 1).To4(),
+			output: "cb.example.com. A\n",
+		},
+		{
+			name:   "outside zone",
+			req:    dnsQuery(4, token+".example.org", dnsTypeA),
+			rcode:  dnsRcodeRefused,
+			output: token + ".example.org. A\n",
+		},
+		{
+			name:   "unknown type",
+			req:    dnsQuery(5, "cb.example.com", 65),
+			output: "cb.example.com. TYPE65\n",
+		},
+		{
+			name:  "malformed",
+			req:   dnsQuery(6, "cb.example.com", dnsTypeA)[:dnsHeaderLen+3],
+			rcode: dnsRcodeFormErr,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &output{}
+			d := NewDNS("dns", "cb.example.com.", token, net.IPv4(10, 0, 0, 1), out)
+
+			if err := d.Listen("127.0.0.1:0"); err != nil {
+				t.Fatal(err)
+			}
+			defer d.Close()
+
+			conn, err := net.Dial("udp", d.conn.LocalAddr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			if _, err := conn.Write(tt.req); err != nil {
+				t.Fatal(err)
+			}
+
+			_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+			resp := make([]byte, 512)
+
+			n, err := conn.Read(resp)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp = resp[:n]
+
+			if !bytes.Equal(resp[:2], tt.req[:2]) {
+				t.Errorf("response id = %x, want %x", resp[:2], tt.req[:2])
+			}
+
+			if resp[2]&0x80 == 0 || resp[2]&0x04 == 0 || resp[2]&0x01 == 0 {
+				t.Errorf("response flags = %08b, want QR, AA and RD set", resp[2])
+			}
+
+			if resp[3] != tt.rcode {
+				t.Errorf("rcode = %d, want %d", resp[3], tt.rcode)
+			}
+
+			an := binary.BigEndian.Uint16(resp[6:8])
+
+			switch {
+			case tt.answer == nil && an != 0:
+				t.Errorf("answers = %d, want 0", an)
+			case tt.answer != nil && (an != 1 || !bytes.Equal(resp[len(resp)-4:], tt.answer)):
+				t.Errorf("answers = %d with address %v, want %v", an, net.IP(resp[len(resp)-4:]), tt.answer)
+			}
+
+			if tt.rcode == dnsRcodeFormErr {
+				return
+			}
+
+			matched := "0"
+			if tt.matched {
+				matched = "1"
+			}
+
+			v := d.Values()
+			if v["dns_queries"] != "1" || v["dns_matched_queries"] != matched {
+				t.Errorf("values = %v, want 1 query and %s matched", v, matched)
+			}
+
+			if !strings.Contains(out.String(), tt.output) {
+				t.Errorf("output does not contain %q:\n%s", tt.output, out.String())
+			}
+		})
+	}
+}
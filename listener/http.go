@@ -0,0 +1,115 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package listener
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maxRequestBody = 1 << 20
+
+// HTTP is a callback listener that records every incoming request.
+type HTTP struct {
+	name  string
+	token string
+	out   io.Writer
+
+	mu       sync.Mutex
+	srv      *http.Server
+	requests int
+	matched  int
+	done     chan struct{}
+}
+
+// NewHTTP creates HTTP callback listener that writes request dumps to out.
+// Request counters are exposed as values prefixed with name.
+func NewHTTP(name, token string, out io.Writer) *HTTP {
+	return &HTTP{
+		name:  name,
+		token: token,
+		out:   out,
+	}
+}
+
+func (h *HTTP) Listen(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	h.srv = &http.Server{
+		Handler:           h,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	h.done = make(chan struct{})
+
+	go func() {
+		defer close(h.done)
+
+		_ = h.srv.Serve(l)
+	}()
+
+	return nil
+}
+
+func (h *HTTP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBody)
+
+	dump, err := httputil.DumpRequest(r, true)
+	if err != nil {
+		dump = []byte(fmt.Sprintf("%s %s %s\nfailed to read request: %s", r.Method, r.RequestURI, r.Proto, err.Error()))
+	}
+
+	matched := h.token != "" && (strings.Contains(r.RequestURI, h.token) || strings.Contains(r.Host, h.token))
+
+	h.mu.Lock()
+	h.requests++
+	id := h.requests
+
+	if matched {
+		h.matched++
+	}
+
+	fmt.Fprintf(h.out, "=== request %d from %s token=%t\n%s\n", id, r.RemoteAddr, matched, strings.ReplaceAll(string(dump), "\r\n", "\n"))
+	h.mu.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *HTTP) Values() map[string]string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return map[string]string{
+		h.name + "_requests":         strconv.Itoa(h.requests),
+		h.name + "_matched_requests": strconv.Itoa(h.matched),
+	}
+}
+
+func (h *HTTP) Close() error {
+	if h.srv == nil {
+		return nil
+	}
+
+	err := h.srv.Close()
+
+	<-h.done
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+var _ Listener = &HTTP{}
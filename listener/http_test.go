@@ -0,0 +1,91 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package listener
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// freePort returns loopback address with free TCP port.
+func freePort(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	return l.Addr().String()
+}
+
+func TestHTTP(t *testing.T) {
+	const token = "a1b2c3d4"
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		host    string
+		body    string
+		matched bool
+	}{
+		{name: "token in path", method: http.MethodGet, path: "/" + token, matched: true},
+		{name: "token in query", method: http.MethodGet, path: "/callback?id=" + token, matched: true},
+		{name: "token in host", method: http.MethodGet, path: "/", host: token + ".example.com", matched: true},
+		{name: "no token", method: http.MethodGet, path: "/index.html"},
+		{name: "token in body", method: http.MethodPost, path: "/upload", body: "data=" + token},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &output{}
+			h := NewHTTP("callback", token, out)
+
+			addr := freePort(t)
+			if err := h.Listen(addr); err != nil {
+				t.Fatal(err)
+			}
+			defer h.Close()
+
+			req, err := http.NewRequest(tt.method, "http://"+addr+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.host != "" {
+				req.Host = tt.host
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+			}
+
+			matched := "0"
+			if tt.matched {
+				matched = "1"
+			}
+
+			v := h.Values()
+			if v["callback_requests"] != "1" || v["callback_matched_requests"] != matched {
+				t.Errorf("values = %v, want 1 request and %s matched", v, matched)
+			}
+
+			for _, s := range []string{"=== request 1 from 127.0.0.1:", tt.method + " " + tt.path + " HTTP/1.1\n", tt.body} {
+				if !strings.Contains(out.String(), s) {
+					t.Errorf("output does not contain %q:\n%s", s, out.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+// Package listener implements services that run inside vilks process.
+package listener
+
+import (
+	"io"
+)
+
+// Listener is a service running inside vilks process.
+type Listener interface {
+	io.Closer
+
+	// Listen starts accepting connections on given address.
+	Listen(addr string) error
+	// Values returns values captured by the listener so far.
+	Values() map[string]string
+}
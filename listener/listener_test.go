@@ -0,0 +1,47 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package listener
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// output is a transcript writer safe for concurrent use.
+type output struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.buf.Write(p)
+}
+
+func (o *output) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.buf.String()
+}
+
+// waitOutput waits for transcript to contain s.
+func waitOutput(t *testing.T, out *output, s string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for !strings.Contains(out.String(), s) {
+		if time.Now().After(deadline) {
+			t.Fatalf("output does not contain %q:\n%s", s, out.String())
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package listener
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"regexp"
+	"sync"
+	"time"
+
+	"vilks.io/vilks/recipe"
+)
+
+const defaultExpectTimeout = 30 * time.Second
+
+// Shell is a reverse shell listener that runs a script on every caught shell.
+type Shell struct {
+	script []recipe.Interaction
+	out    io.Writer
+
+	mu       sync.Mutex
+	l        net.Listener
+	conns    map[net.Conn]struct{}
+	values   map[string]string
+	sessions int
+	wg       sync.WaitGroup
+}
+
+// NewShell creates reverse shell listener that writes session transcripts to out.
+func NewShell(script []recipe.Interaction, out io.Writer) *Shell {
+	return &Shell{
+		script: script,
+		out:    out,
+		conns:  make(map[net.Conn]struct{}),
+		values: make(map[string]string),
+	}
+}
+
+func (s *Shell) Listen(addr string) error {
+	for _, step := range s.script {
+		if _, err := regexp.Compile(step.Expect); err != nil {
+			return err
+		}
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	s.l = l
+
+	s.wg.Add(1)
+
+	go s.accept()
+
+	return nil
+}
+
+func (s *Shell) accept() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.sessions++
+		id := s.sessions
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+
+		go func() {
+			defer s.wg.Done()
+
+			s.handle(id, conn)
+
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+func (s *Shell) handle(id int, conn net.Conn) {
+	defer conn.Close()
+
+	fmt.Fprintf(s.out, "=== session %d from %s\n", id, conn.RemoteAddr())
+
+	sess := &session{conn: conn, out: s.out}
+
+	if err := sess.run(s.script, s.capture); err != nil {
+		fmt.Fprintf(s.out, "=== session %d failed: %s\n", id, err.Error())
+
+		return
+	}
+
+	if len(s.script) == 0 {
+		// Passive listener, record everything until remote closes connection.
+		_, _ = io.Copy(s.out, conn)
+	}
+
+	fmt.Fprintf(s.out, "=== session %d closed\n", id)
+}
+
+func (s *Shell) capture(name, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.values[name] = value
+}
+
+func (s *Shell) Values() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return maps.Clone(s.values)
+}
+
+func (s *Shell) Close() error {
+	if s.l == nil {
+		return nil
+	}
+
+	err := s.l.Close()
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+
+	return err
+}
+
+type session struct {
+	conn net.Conn
+	out  io.Writer
+	buf  []byte
+}
+
+func (s *session) run(script []recipe.Interaction, capture func(name, value string)) error {
+	for _, step := range script {
+		if step.Send != "" {
+			fmt.Fprintf(s.out, "> %s\n", step.Send)
+
+			if _, err := io.WriteString(s.conn, step.Send+"\n"); err != nil {
+				return err
+			}
+		}
+
+		if step.Expect == "" {
+			continue
+		}
+
+		timeout := step.Timeout
+		if timeout <= 0 {
+			timeout = defaultExpectTimeout
+		}
+
+		m, err := s.expect(regexp.MustCompile(step.Expect), timeout)
+		if err != nil {
+			return fmt.Errorf("expected '%s': %w", step.Expect, err)
+		}
+
+		if step.Capture != "" {
+			capture(step.Capture, m)
+		}
+	}
+
+	return nil
+}
+
+// expect reads from connection until output matches regexp and returns
+// first capture group or whole match if regexp has no groups.
+func (s *session) expect(re *regexp.Regexp, timeout time.Duration) (string, error) {
+	if err := s.conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = s.conn.SetReadDeadline(time.Time{})
+	}()
+
+	data := make([]byte, 4096)
+
+	for {
+		if loc := re.FindSubmatchIndex(s.buf); loc != nil {
+			m := s.buf[loc[0]:loc[1]]
+			if len(loc) >= 4 && loc[2] >= 0 {
+				m = s.buf[loc[2]:loc[3]]
+			}
+
+			v := string(m)
+			s.buf = s.buf[loc[1]:]
+
+			return v, nil
+		}
+
+		n, err := s.conn.Read(data)
+		if n > 0 {
+			s.buf = append(s.buf, data[:n]...)
+			_, _ = s.out.Write(data[:n])
+		}
+
+		var nerr net.Error
+		if errors.As(err, &nerr) && nerr.Timeout() {
+			return "", fmt.Errorf("timed out after %s", timeout)
+		}
+
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+var _ Listener = &Shell{}
@@ -0,0 +1,125 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package listener
+
+import (
+	"bufio"
+	"io"
+	"maps"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"vilks.io/vilks/recipe"
+)
+
+// fakeShell connects to the listener and answers commands like a reverse shell.
+func fakeShell(t *testing.T, addr, banner string, responses map[string]string) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		defer conn.Close()
+
+		if _, err := io.WriteString(conn, banner); err != nil {
+			return
+		}
+
+		sc := bufio.NewScanner(conn)
+		for sc.Scan() {
+			if _, err := io.WriteString(conn, responses[sc.Text()]+"\n$ "); err != nil {
+				return
+			}
+		}
+	}()
+}
+
+func TestShell(t *testing.T) {
+	tests := []struct {
+		name      string
+		script    []recipe.Interaction
+		banner    string
+		responses map[string]string
+		values    map[string]string
+		output    []string
+	}{
+		{
+			name: "capture group",
+			script: []recipe.Interaction{
+				{Expect: `\$ `},
+				{Send: "id", Expect: `uid=(\d+)`, Capture: "uid"},
+				{Send: "hostname", Expect: `\$ (\S+)\n`, Capture: "hostname"},
+			},
+			banner:    "$ ",
+			responses: map[string]string{"id": "uid=0(root) gid=0(root)", "hostname": "web01"},
+			values:    map[string]string{"uid": "0", "hostname": "web01"},
+			output:    []string{"> id\n", "uid=0(root)", "> hostname\n", "=== session 1 closed"},
+		},
+		{
+			name: "whole match",
+			script: []recipe.Interaction{
+				{Send: "cat /flag", Expect: `FLAG\{\w+\}`, Capture: "flag"},
+			},
+			responses: map[string]string{"cat /flag": "FLAG{secret}"},
+			values:    map[string]string{"flag": "FLAG{secret}"},
+			output:    []string{"> cat /flag\n", "=== session 1 closed"},
+		},
+		{
+			name: "expect timeout",
+			script: []recipe.Interaction{
+				{Send: "id", Expect: `uid=1000`, Capture: "uid", Timeout: 200 * time.Millisecond},
+			},
+			responses: map[string]string{"id": "uid=0(root)"},
+			values:    map[string]string{},
+			output:    []string{"=== session 1 failed: expected 'uid=1000': timed out after 200ms"},
+		},
+		{
+			name:   "passive",
+			banner: "connected\n",
+			values: map[string]string{},
+			output: []string{"connected\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &output{}
+			s := NewShell(tt.script, out)
+
+			if err := s.Listen("127.0.0.1:0"); err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+
+			fakeShell(t, s.l.Addr().String(), tt.banner, tt.responses)
+
+			for _, o := range tt.output {
+				waitOutput(t, out, o)
+			}
+
+			if v := s.Values(); !maps.Equal(v, tt.values) {
+				t.Errorf("values = %v, want %v", v, tt.values)
+			}
+
+			if !strings.HasPrefix(out.String(), "=== session 1 from 127.0.0.1:") {
+				t.Errorf("transcript does not start with session header:\n%s", out.String())
+			}
+		})
+	}
+}
+
+func TestShellInvalidExpect(t *testing.T) {
+	s := NewShell([]recipe.Interaction{{Expect: `(`}}, &output{})
+
+	if err := s.Listen("127.0.0.1:0"); err == nil {
+		_ = s.Close()
+
+		t.Fatal("expected error for invalid expect regexp")
+	}
+}
@@ -5,6 +5,7 @@ package logger
 
 import (
 	"fmt"
+	"io"
 
 	"github.com/fatih/color"
 )
@@ -38,6 +39,10 @@ func (c *Console) Special(data string) string {
 	return color.MagentaString(data)
 }
 
+func (c *Console) Warn(msg string) {
+	color.HiYellow("[-] %s", color.YellowString(msg))
+}
+
 func (c *Console) Error(msg string) {
 	color.HiRed("[!] %s", color.RedString(msg))
 }
@@ -67,4 +72,24 @@ func (c *Console) Console(title string, data []byte) {
 	color.White("-------------------------")
 }
 
+func (c *Console) Stream(prefix string) io.WriteCloser {
+	if !c.debug {
+		return nopWriteCloser{io.Discard}
+	}
+
+	return &lineWriter{
+		fn: func(line string) {
+			fmt.Println(color.WhiteString("[*]"), color.MagentaString(prefix), line)
+		},
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
 var _ Logger = &Console{}
@@ -3,12 +3,19 @@
 
 package logger
 
+import (
+	"io"
+)
+
 // Logger is the interface that wraps the basic logging methods.
 type Logger interface {
 	SetDebug(debug bool)
 	Info(msg string, params ...any)
+	Warn(msg string)
 	Error(msg string)
 	Debug(msg string)
 	Console(title string, data []byte)
+	// Stream returns writer that outputs every written line prefixed with prefix.
+	Stream(prefix string) io.WriteCloser
 	Special(data string) string
 }
@@ -0,0 +1,78 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package logger
+
+import (
+	"io"
+
+	"vilks.io/vilks/secret"
+)
+
+type masked struct {
+	Logger
+	m *secret.Masker
+}
+
+// Masked returns logger that masks secret values in all output.
+func Masked(l Logger, m *secret.Masker) Logger {
+	return &masked{Logger: l, m: m}
+}
+
+func (l *masked) Info(msg string, params ...any) {
+	prms := make([]any, 0, len(params))
+
+	for _, p := range params {
+		switch p := p.(type) {
+		case map[string]string:
+			prms = append(prms, l.m.MaskValues(p))
+		case string:
+			prms = append(prms, l.m.Mask(p))
+		default:
+			prms = append(prms, p)
+		}
+	}
+
+	l.Logger.Info(l.m.Mask(msg), prms...)
+}
+
+func (l *masked) Warn(msg string) {
+	l.Logger.Warn(l.m.Mask(msg))
+}
+
+func (l *masked) Error(msg string) {
+	l.Logger.Error(l.m.Mask(msg))
+}
+
+func (l *masked) Debug(msg string) {
+	l.Logger.Debug(l.m.Mask(msg))
+}
+
+func (l *masked) Console(title string, data []byte) {
+	l.Logger.Console(l.m.Mask(title), l.m.MaskBytes(data))
+}
+
+// Stream masks output line by line so that secrets split between writes are masked.
+func (l *masked) Stream(prefix string) io.WriteCloser {
+	w := l.Logger.Stream(prefix)
+
+	return &maskedStream{
+		lineWriter: lineWriter{
+			fn: func(line string) {
+				_, _ = io.WriteString(w, l.m.Mask(line)+"\n")
+			},
+		},
+		w: w,
+	}
+}
+
+type maskedStream struct {
+	lineWriter
+	w io.WriteCloser
+}
+
+func (s *maskedStream) Close() error {
+	_ = s.lineWriter.Close()
+
+	return s.w.Close()
+}
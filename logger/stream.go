@@ -0,0 +1,51 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package logger
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// lineWriter calls fn for every complete line written to it.
+type lineWriter struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+	fn  func(line string)
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf.Write(p)
+
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+
+		line := w.buf.Next(i + 1)
+		w.fn(string(bytes.TrimRight(line, "\r\n")))
+	}
+
+	return len(p), nil
+}
+
+// Close outputs remaining incomplete line.
+func (w *lineWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.buf.Len() > 0 {
+		w.fn(w.buf.String())
+		w.buf.Reset()
+	}
+
+	return nil
+}
+
+var _ io.WriteCloser = &lineWriter{}
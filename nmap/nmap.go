@@ -0,0 +1,195 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+// Package nmap reads nmap XML scan output.
+package nmap
+
+import (
+	"encoding/xml"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Run is the nmap scan result.
+type Run struct {
+	Hosts []*Host `xml:"host"`
+}
+
+// Host is the scanned host.
+type Host struct {
+	Status    Status     `xml:"status"`
+	Addresses []Address  `xml:"address"`
+	Hostnames []Hostname `xml:"hostnames>hostname"`
+	Ports     []*Port    `xml:"ports>port"`
+}
+
+type Status struct {
+	State string `xml:"state,attr"`
+}
+
+type Address struct {
+	Addr     string `xml:"addr,attr"`
+	AddrType string `xml:"addrtype,attr"`
+}
+
+type Hostname struct {
+	Name string `xml:"name,attr"`
+}
+
+// Port is the scanned port of host.
+type Port struct {
+	Protocol string    `xml:"protocol,attr"`
+	PortID   int       `xml:"portid,attr"`
+	State    PortState `xml:"state"`
+	Service  Service   `xml:"service"`
+}
+
+type PortState struct {
+	State string `xml:"state,attr"`
+}
+
+type Service struct {
+	Name    string `xml:"name,attr"`
+	Product string `xml:"product,attr"`
+	Tunnel  string `xml:"tunnel,attr"`
+}
+
+// Parse parses nmap XML output.
+func Parse(data []byte) (*Run, error) {
+	var r Run
+	if err := xml.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// ParseFile parses nmap XML output file.
+func ParseFile(path string) (*Run, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(data)
+}
+
+// Up returns hosts that are up.
+func (r *Run) Up() []*Host {
+	hosts := make([]*Host, 0, len(r.Hosts))
+
+	for _, h := range r.Hosts {
+		if h.Status.State == "" || h.Status.State == "up" {
+			hosts = append(hosts, h)
+		}
+	}
+
+	return hosts
+}
+
+// Find returns first host that is up matching address, network in CIDR
+// notation or host name regular expression.
+func (r *Run) Find(match string) (*Host, error) {
+	_, network, cidrErr := net.ParseCIDR(match)
+
+	var re *regexp.Regexp
+
+	if cidrErr != nil && net.ParseIP(match) == nil {
+		var err error
+		if re, err = regexp.Compile("^(?:" + match + ")$"); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, h := range r.Up() {
+		for _, a := range h.Addresses {
+			ip := net.ParseIP(a.Addr)
+			if ip == nil {
+				continue
+			}
+
+			if (network != nil && network.Contains(ip)) || a.Addr == match {
+				return h, nil
+			}
+		}
+
+		if re == nil {
+			continue
+		}
+
+		for _, n := range h.Hostnames {
+			if re.MatchString(n.Name) || re.MatchString(strings.SplitN(n.Name, ".", 2)[0]) {
+				return h, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// Address returns host IP address, IPv4 address is preferred.
+func (h *Host) Address() string {
+	var addr string
+
+	for _, a := range h.Addresses {
+		switch a.AddrType {
+		case "ipv4":
+			return a.Addr
+		case "ipv6":
+			if addr == "" {
+				addr = a.Addr
+			}
+		}
+	}
+
+	return addr
+}
+
+// Hostname returns first host name or empty string.
+func (h *Host) Hostname() string {
+	if len(h.Hostnames) == 0 {
+		return ""
+	}
+
+	return h.Hostnames[0].Name
+}
+
+// OpenPorts returns open ports of host.
+func (h *Host) OpenPorts() []*Port {
+	ports := make([]*Port, 0, len(h.Ports))
+
+	for _, p := range h.Ports {
+		if p.State.State == "open" {
+			ports = append(ports, p)
+		}
+	}
+
+	return ports
+}
+
+// Port returns first open port with service name or port number.
+func (h *Host) Port(service string) *Port {
+	for _, p := range h.OpenPorts() {
+		if p.Name() == service || p.Service.Name == service || strconv.Itoa(p.PortID) == service {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// Name returns port service name, or protocol and port number if service is unknown.
+func (p *Port) Name() string {
+	if p.Service.Name != "" {
+		if p.Service.Tunnel == "ssl" && p.Service.Name == "http" {
+			return "https"
+		}
+
+		return p.Service.Name
+	}
+
+	return p.Protocol + strconv.Itoa(p.PortID)
+}
@@ -0,0 +1,148 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package nmap
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseFile(t *testing.T) {
+	run, err := ParseFile("../sample/nmap/team1.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(run.Hosts) != 2 {
+		t.Fatalf("hosts = %d, want 2", len(run.Hosts))
+	}
+
+	up := run.Up()
+	if len(up) != 1 {
+		t.Fatalf("hosts up = %d, want 1", len(up))
+	}
+
+	h := up[0]
+
+	if h.Address() != "172.46.64.98" || h.Hostname() != "web.team1.lab" {
+		t.Errorf("host = %s %s, want 172.46.64.98 web.team1.lab", h.Address(), h.Hostname())
+	}
+
+	var open []string
+	for _, p := range h.OpenPorts() {
+		open = append(open, p.Name())
+	}
+
+	if !slices.Equal(open, []string{"ssh", "http"}) {
+		t.Errorf("open ports = %v, want [ssh http]", open)
+	}
+}
+
+func TestParse(t *testing.T) {
+	run, err := Parse([]byte(`<nmaprun>
+<host><status state="up"/>
+<address addr="fe80::1" addrtype="ipv6"/>
+<address addr="10.0.0.5" addrtype="ipv4"/>
+<address addr="00:11:22:33:44:55" addrtype="mac"/>
+<ports>
+<port protocol="tcp" portid="443"><state state="open"/><service name="http" tunnel="ssl"/></port>
+<port protocol="tcp" portid="8443"><state state="open"/><service name="https-alt"/></port>
+<port protocol="udp" portid="161"><state state="open"/></port>
+<port protocol="tcp" portid="25"><state state="closed"/><service name="smtp"/></port>
+</ports>
+</host>
+</nmaprun>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := run.Hosts[0]
+
+	if h.Address() != "10.0.0.5" {
+		t.Errorf("address = %s, want IPv4 address 10.0.0.5", h.Address())
+	}
+
+	if h.Hostname() != "" {
+		t.Errorf("hostname = %s, want empty", h.Hostname())
+	}
+
+	tests := []struct {
+		service string
+		port    int
+	}{
+		{service: "https", port: 443},
+		{service: "http", port: 443},
+		{service: "https-alt", port: 8443},
+		{service: "8443", port: 8443},
+		{service: "udp161", port: 161},
+		{service: "smtp"},
+		{service: "25"},
+		{service: "ssh"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.service, func(t *testing.T) {
+			p := h.Port(tt.service)
+
+			switch {
+			case tt.port == 0 && p != nil:
+				t.Errorf("port = %d, want none", p.PortID)
+			case tt.port != 0 && (p == nil || p.PortID != tt.port):
+				t.Errorf("port = %v, want %d", p, tt.port)
+			}
+		})
+	}
+
+	if _, err := Parse([]byte("<nmaprun>")); err == nil {
+		t.Error("expected error for invalid XML")
+	}
+}
+
+func TestFind(t *testing.T) {
+	run, err := ParseFile("../sample/nmap/team2.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		match string
+		addr  string
+		err   bool
+	}{
+		{match: "172.46.64.99", addr: "172.46.64.99"},
+		{match: "172.46.64.0/24", addr: "172.46.64.99"},
+		{match: "web", addr: "172.46.64.99"},
+		{match: "web.team2.lab", addr: "172.46.64.99"},
+		{match: `web\.team\d\.lab`, addr: "172.46.64.99"},
+		{match: "we"},
+		{match: "172.46.64.12"},
+		{match: "10.0.0.0/8"},
+		{match: "db"},
+		{match: "(", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.match, func(t *testing.T) {
+			h, err := run.Find(tt.match)
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			switch {
+			case tt.addr == "" && h != nil:
+				t.Errorf("found %s, want none", h.Address())
+			case tt.addr != "" && (h == nil || h.Address() != tt.addr):
+				t.Errorf("found %v, want %s", h, tt.addr)
+			}
+		})
+	}
+}
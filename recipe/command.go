@@ -0,0 +1,74 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package recipe
+
+import (
+	"github.com/goccy/go-yaml"
+)
+
+// Command is a step command. It can be specified as a plain string.
+type Command struct {
+	// Run is the shell command to execute.
+	Run string `json:"run"`
+	// Stdin is the input passed to the command.
+	Stdin *Stdin `json:"stdin,omitempty"`
+	// TTY is a flag indicating if command should be executed with a terminal attached.
+	TTY bool `json:"tty,omitempty"`
+	// Conditions are the output conditions of the command, overrides step conditions.
+	Conditions *Conditions `json:"conditions,omitempty"`
+	// AllowFailure is a flag indicating if step should continue when command fails.
+	AllowFailure bool `json:"allow_failure,omitempty"`
+	// ExpectedExitCodes is the list of exit codes considered successful, defaults to 0.
+	ExpectedExitCodes []int `json:"expected_exit_codes,omitempty"`
+	// Capture is the evidence name to store command output as.
+	Capture string `json:"capture,omitempty"`
+	// IgnoreOutput is a flag indicating if command output should not be stored as evidence
+	// or used for output evidence of the step.
+	IgnoreOutput bool `json:"ignore_output,omitempty"`
+}
+
+// ExitCodes returns exit codes considered successful.
+func (c *Command) ExitCodes() []int {
+	if len(c.ExpectedExitCodes) == 0 {
+		return []int{0}
+	}
+
+	return c.ExpectedExitCodes
+}
+
+func (c *Command) UnmarshalYAML(data []byte) error {
+	var run string
+	if err := yaml.Unmarshal(data, &run); err == nil {
+		c.Run = run
+
+		return nil
+	}
+
+	type plain Command
+
+	return yaml.Unmarshal(data, (*plain)(c))
+}
+
+// Stdin is the command input. It can be specified as a plain string.
+type Stdin struct {
+	// Data is the inline input, parameters are substituted.
+	Data string `json:"data,omitempty"`
+	// FromParam is the name of parameter to use as input.
+	FromParam string `json:"from_param,omitempty"`
+	// FromFile is the workspace file path to use as input.
+	FromFile string `json:"from_file,omitempty"`
+}
+
+func (s *Stdin) UnmarshalYAML(data []byte) error {
+	var d string
+	if err := yaml.Unmarshal(data, &d); err == nil {
+		s.Data = d
+
+		return nil
+	}
+
+	type plain Stdin
+
+	return yaml.Unmarshal(data, (*plain)(s))
+}
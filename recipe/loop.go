@@ -0,0 +1,80 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package recipe
+
+import (
+	"errors"
+)
+
+const DefaultForeachParam = "item"
+
+// LoopOptions are the options of looping step execution. Evidence and output
+// of each iteration are stored with iteration number suffix, e.g. "name_1".
+type LoopOptions struct {
+	// Concurrency is the maximum number of iterations executed in parallel, defaults to 1.
+	// It can not be used when scenario assigns static network address to step containers.
+	Concurrency int `json:"concurrency,omitempty"`
+	// StopOnSuccess is a flag indicating if remaining iterations should be stopped after
+	// first successful one. Step fails only if none of iterations succeeds.
+	StopOnSuccess bool `json:"stop_on_success,omitempty"`
+	// Capture is the evidence name to store values of the successful iteration as.
+	Capture string `json:"capture,omitempty"`
+}
+
+// Foreach executes step for each of the items.
+type Foreach struct {
+	// Param is the name of the parameter iteration value is exposed as, defaults to "item".
+	Param string `json:"param,omitempty"`
+	// Items are the values to iterate over. Parameters are substituted and values
+	// containing multiple lines are split into separate items.
+	Items []string `json:"items"`
+
+	LoopOptions `json:",inline"`
+}
+
+// ParamName returns name of the iteration parameter.
+func (f *Foreach) ParamName() string {
+	if f.Param == "" {
+		return DefaultForeachParam
+	}
+
+	return f.Param
+}
+
+// Matrix executes step for each combination of parameter values.
+type Matrix struct {
+	// Params are the parameter names with values to combine. Values are
+	// handled the same way as foreach items.
+	Params map[string][]string `json:"params"`
+
+	LoopOptions `json:",inline"`
+}
+
+// Loop returns step loop options or nil if step is not looping.
+func (s *Step) Loop() *LoopOptions {
+	switch {
+	case s.Foreach != nil:
+		return &s.Foreach.LoopOptions
+	case s.Matrix != nil:
+		return &s.Matrix.LoopOptions
+	default:
+		return nil
+	}
+}
+
+func (s *Step) validateLoop() error {
+	if s.Foreach != nil && s.Matrix != nil {
+		return errors.New("foreach and matrix can not be used together")
+	}
+
+	if s.Matrix != nil && len(s.Matrix.Params) == 0 {
+		return errors.New("matrix must have at least one parameter")
+	}
+
+	if l := s.Loop(); l != nil && l.Concurrency < 0 {
+		return errors.New("concurrency can not be negative")
+	}
+
+	return nil
+}
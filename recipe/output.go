@@ -0,0 +1,157 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package recipe
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"vilks.io/vilks/template"
+)
+
+// stepID matches valid step identifiers that can be used in output references.
+var stepID = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Output is a named value extracted from step result for use in later steps.
+type Output struct {
+	// Name is the name of the output, for regexp outputs named groups are used when not set.
+	Name string `json:"name,omitempty"`
+	// Regexp is the regular expression to match step output with.
+	Regexp string `json:"regexp,omitempty"`
+	// JSON is the path to value in JSON step output, e.g. "data.items.0.name".
+	JSON string `json:"json,omitempty"`
+	// File is the path of the file in step container to read value from.
+	File string `json:"file,omitempty"`
+}
+
+func (o *Output) validate() error {
+	n := 0
+	for _, s := range []string{o.Regexp, o.JSON, o.File} {
+		if s != "" {
+			n++
+		}
+	}
+
+	if n != 1 {
+		return errors.New("exactly one of regexp, json or file must be set")
+	}
+
+	if o.Regexp == "" {
+		if o.Name == "" {
+			return errors.New("name is required")
+		}
+
+		return nil
+	}
+
+	r, err := regexp.Compile(o.Regexp)
+	if err != nil {
+		return err
+	}
+
+	if o.Name == "" && r.NumSubexp() == 0 {
+		return errors.New("name is required for regexp without named groups")
+	}
+
+	for i, name := range r.SubexpNames() {
+		if i > 0 && o.Name == "" && name == "" {
+			return fmt.Errorf("regexp group %d must be named", i)
+		}
+	}
+
+	return nil
+}
+
+// names returns names of values set by output.
+func (o *Output) names() []string {
+	if o.Name != "" || o.Regexp == "" {
+		return []string{o.Name}
+	}
+
+	r, err := regexp.Compile(o.Regexp)
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+
+	for _, name := range r.SubexpNames() {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// validateOutputRefs checks that step identifiers are valid and unique and
+// that steps reference only declared outputs of previous steps.
+func (r *Recipe) validateOutputRefs() error {
+	outputs := make(map[string][]string, len(r.Steps))
+
+	for _, step := range r.Steps {
+		if step.ID != "" && !stepID.MatchString(step.ID) {
+			return fmt.Errorf("step '%s' id '%s' can contain only letters, digits, '_' and '-'", step.Name, step.ID)
+		}
+
+		for _, t := range step.templates() {
+			refs, err := template.Refs(t)
+			if err != nil {
+				return fmt.Errorf("step '%s': %w", step.Name, err)
+			}
+
+			for _, ref := range refs {
+				if err := checkOutputRef(ref, outputs); err != nil {
+					return fmt.Errorf("step '%s': %w", step.Name, err)
+				}
+			}
+		}
+
+		ref := strings.ToLower(step.Ref())
+		if _, ok := outputs[ref]; ok {
+			return fmt.Errorf("duplicate step '%s', set unique step id", step.Ref())
+		}
+
+		names := make([]string, 0, len(step.Outputs))
+		for i := range step.Outputs {
+			names = append(names, step.Outputs[i].names()...)
+		}
+
+		outputs[ref] = names
+	}
+
+	return nil
+}
+
+// checkOutputRef checks that step output reference is to declared output.
+func checkOutputRef(ref string, outputs map[string][]string) error {
+	rest, ok := strings.CutPrefix(ref, "steps.")
+	if !ok {
+		return nil
+	}
+
+	step, key, ok := strings.Cut(rest, ".outputs.")
+	if !ok || key == "" {
+		return fmt.Errorf("invalid step output reference '%s', expected steps.<id>.outputs.<name>", ref)
+	}
+
+	names, ok := outputs[strings.ToLower(step)]
+	if !ok {
+		return fmt.Errorf("output reference '%s' to unknown or later step '%s', steps with names that are not valid identifiers must have id", ref, step)
+	}
+
+	if !slices.ContainsFunc(names, func(name string) bool { return strings.EqualFold(name, key) }) {
+		return fmt.Errorf("output reference '%s' to undeclared output '%s' of step '%s'", ref, key, step)
+	}
+
+	return nil
+}
+
+// OutputParam returns parameter name of step output value.
+func OutputParam(step, key string) string {
+	return "steps." + step + ".outputs." + key
+}
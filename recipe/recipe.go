@@ -4,6 +4,10 @@
 package recipe
 
 import (
+	"fmt"
+
+	"vilks.io/vilks/template"
+
 	"github.com/goccy/go-yaml"
 )
 
@@ -13,12 +17,23 @@ type Recipe struct {
 	Name string `json:"name"`
 	// Params is the list of input parameters for the recipe.
 	Params Params `json:"params"`
+	// Requires is the host capabilities required by the recipe.
+	Requires *Requirements `json:"requires,omitempty"`
 	// Workspace is the list of workspace items for the recipe.
 	Workspace []*WorkspaceItem `json:"workspace"`
 	// Services is the list of services to run in the recipe.
 	Services []*Service `json:"services"`
 	// Steps is the list of steps to execute in the recipe.
 	Steps []*Step `json:"steps"`
+	// Network is the network configuration of the recipe.
+	Network *Network `json:"network,omitempty"`
+}
+
+// Network is the network configuration of a recipe.
+type Network struct {
+	// Isolated is a flag indicating if a dedicated network should be created for every attack.
+	// Services are reachable from steps in this network by their alias.
+	Isolated bool `json:"isolated"`
 }
 
 // Params is a map of input parameters for a recipe.
@@ -40,6 +55,9 @@ func (p *Params) UnmarshalYAML(data []byte) error {
 	return nil
 }
 
+// ParamTypeSecret is the type of parameter with secret value that is masked in logs and evidence.
+const ParamTypeSecret = "secret"
+
 // Param is an input parameter for a recipe.
 type Param struct {
 	// Name is the name of the parameter.
@@ -63,9 +81,80 @@ func Load(data []byte) (*Recipe, error) {
 	return &r, nil
 }
 
+// Validate checks recipe for errors.
+func (r *Recipe) Validate() error {
+	for _, item := range r.Workspace {
+		if err := validateTemplates(item.Source, item.Target); err != nil {
+			return fmt.Errorf("workspace item '%s': %w", item.Target, err)
+		}
+	}
+
+	for _, svc := range r.Services {
+		if err := template.Validate(svc.Command); err != nil {
+			return fmt.Errorf("service '%s' command: %w", svc.Name, err)
+		}
+
+		if err := svc.Resources.Validate(); err != nil {
+			return fmt.Errorf("service '%s' resources: %w", svc.Name, err)
+		}
+
+		for _, p := range svc.Ports {
+			if p.Base < 0 || p.Base > 65535 {
+				return fmt.Errorf("service '%s' port '%s' base %d is out of range 0-65535", svc.Name, p.Name, p.Base)
+			}
+		}
+	}
+
+	for _, step := range r.Steps {
+		if err := step.validateLoop(); err != nil {
+			return fmt.Errorf("step '%s': %w", step.Name, err)
+		}
+
+		if err := step.Resources.Validate(); err != nil {
+			return fmt.Errorf("step '%s' resources: %w", step.Name, err)
+		}
+
+		for _, c := range step.Commands {
+			if err := template.Validate(c.Run); err != nil {
+				return fmt.Errorf("step '%s' command: %w", step.Name, err)
+			}
+		}
+
+		for k, v := range step.Environment {
+			if v, ok := v.(string); ok {
+				if err := template.Validate(v); err != nil {
+					return fmt.Errorf("step '%s' environment variable '%s': %w", step.Name, k, err)
+				}
+			}
+		}
+
+		for i := range step.Outputs {
+			if err := step.Outputs[i].validate(); err != nil {
+				return fmt.Errorf("step '%s' output %d: %w", step.Name, i+1, err)
+			}
+		}
+	}
+
+	if err := r.validateOutputRefs(); err != nil {
+		return err
+	}
+
+	return r.ValidateConditions()
+}
+
 type WorkspaceItem struct {
 	// Source is the source path of the item.
 	Source string `json:"source"`
 	// Target is the target path of the item.
 	Target string `json:"target"`
 }
+
+func validateTemplates(s ...string) error {
+	for _, v := range s {
+		if err := template.Validate(v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
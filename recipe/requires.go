@@ -0,0 +1,15 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package recipe
+
+// Requirements are the host capabilities recipe requires.
+type Requirements struct {
+	// OS is the required host operating system.
+	OS string `json:"os,omitempty"`
+	// Services are the services that must be running on host.
+	Services []string `json:"services,omitempty"`
+	// Ports are the names of host ports that must be defined. First port is
+	// used as target_port parameter if it is not set in attack parameters.
+	Ports []string `json:"ports,omitempty"`
+}
@@ -0,0 +1,92 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package recipe
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+
+	"github.com/docker/go-units"
+)
+
+// Resources limits resources available to a container.
+type Resources struct {
+	// CPUs is the number of CPUs container can use, fractions are allowed.
+	CPUs float64 `json:"cpus,omitempty"`
+	// Memory is the memory limit, e.g. 512m or 2g.
+	Memory string `json:"memory,omitempty"`
+	// PidsLimit is the maximum number of processes in the container.
+	PidsLimit int64 `json:"pids_limit,omitempty"`
+	// Ulimits is the map of ulimits by name with soft and optional hard limit, e.g. nofile: 1024:2048.
+	Ulimits map[string]string `json:"ulimits,omitempty"`
+}
+
+// WithDefaults returns resources with unset limits taken from defaults.
+func (r *Resources) WithDefaults(defaults *Resources) *Resources {
+	if r == nil {
+		return defaults
+	}
+
+	if defaults == nil {
+		return r
+	}
+
+	res := *r
+
+	if res.CPUs == 0 {
+		res.CPUs = defaults.CPUs
+	}
+
+	if res.Memory == "" {
+		res.Memory = defaults.Memory
+	}
+
+	if res.PidsLimit == 0 {
+		res.PidsLimit = defaults.PidsLimit
+	}
+
+	res.Ulimits = maps.Clone(defaults.Ulimits)
+	if res.Ulimits == nil {
+		res.Ulimits = make(map[string]string, len(r.Ulimits))
+	}
+
+	maps.Copy(res.Ulimits, r.Ulimits)
+
+	return &res
+}
+
+// Validate checks that resource limits are valid.
+func (r *Resources) Validate() error {
+	if r == nil {
+		return nil
+	}
+
+	if r.CPUs < 0 {
+		return fmt.Errorf("invalid cpus limit %g", r.CPUs)
+	}
+
+	if r.Memory != "" {
+		mem, err := units.RAMInBytes(r.Memory)
+		if err != nil {
+			return fmt.Errorf("invalid memory limit '%s': %w", r.Memory, err)
+		}
+
+		if mem <= 0 {
+			return fmt.Errorf("invalid memory limit '%s'", r.Memory)
+		}
+	}
+
+	if r.PidsLimit < -1 {
+		return errors.New("pids limit must be -1 for unlimited or greater")
+	}
+
+	for name, val := range r.Ulimits {
+		if _, err := units.ParseUlimit(name + "=" + val); err != nil {
+			return fmt.Errorf("invalid ulimit '%s': %w", name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,39 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package recipe
+
+// Security is the security options of step or service container.
+type Security struct {
+	// User is the user name or UID (with optional group) to run commands as.
+	User string `json:"user,omitempty"`
+	// CapAdd is the list of kernel capabilities to add to the container.
+	CapAdd []string `json:"cap_add,omitempty"`
+	// CapDrop is the list of kernel capabilities to drop from the container.
+	CapDrop []string `json:"cap_drop,omitempty"`
+	// Privileged is a flag indicating if container should run in privileged mode.
+	Privileged bool `json:"privileged,omitempty"`
+	// ReadOnly is a flag indicating if container root filesystem should be read only.
+	ReadOnly bool `json:"read_only,omitempty"`
+	// SecurityOpt is the list of security options, e.g. seccomp=unconfined.
+	SecurityOpt []string `json:"security_opt,omitempty"`
+}
+
+// Privileged returns names of steps and services that request privileged mode.
+func (r *Recipe) Privileged() []string {
+	var names []string
+
+	for _, svc := range r.Services {
+		if svc.Privileged {
+			names = append(names, svc.Name)
+		}
+	}
+
+	for _, step := range r.Steps {
+		if step.Privileged {
+			names = append(names, step.Name)
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,133 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package recipe
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+var nonHostnameChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+type ServiceType string
+
+const (
+	// ServiceTypeContainer is a service running in a container.
+	ServiceTypeContainer ServiceType = "container"
+	// ServiceTypeListener is a built-in reverse shell listener.
+	ServiceTypeListener ServiceType = "listener"
+	// ServiceTypeHTTPListener is a built-in HTTP callback listener.
+	ServiceTypeHTTPListener ServiceType = "http_listener"
+	// ServiceTypeDNSListener is a built-in authoritative DNS callback listener.
+	ServiceTypeDNSListener ServiceType = "dns_listener"
+)
+
+type Service struct {
+	Name      string        `json:"name"`
+	Alias     string        `json:"alias,omitempty"`
+	Type      ServiceType   `json:"type,omitempty"`
+	Image     string        `json:"image"`
+	Command   string        `json:"command"`
+	Ports     []ServicePort `json:"ports"`
+	Readiness []Readiness   `json:"readiness,omitempty"`
+	Resources *Resources    `json:"resources,omitempty"`
+	Security  `json:",inline"`
+	// Script is the list of interactions to run on every shell caught by listener service.
+	Script []Interaction `json:"script,omitempty"`
+	// Token is the name of parameter to expose unique callback token of http and dns listener services.
+	// Callback URL of http listener is exposed as parameter with the same name and _url suffix,
+	// callback domain of dns listener with _domain suffix.
+	Token string `json:"token,omitempty"`
+	// Domain is the domain dns listener service is authoritative for.
+	Domain string `json:"domain,omitempty"`
+	// Evidence is the list of evidence rules matched over service output.
+	// Only output evidence type is supported.
+	Evidence []Evidence `json:"evidence,omitempty"`
+}
+
+// Kind returns service type defaulting to container.
+func (s *Service) Kind() ServiceType {
+	if s.Type == "" {
+		return ServiceTypeContainer
+	}
+
+	return s.Type
+}
+
+// Hostname returns service host name in isolated attack network. Defaults to
+// service name in lower case with non alphanumeric characters replaced by dashes.
+func (s *Service) Hostname() string {
+	if s.Alias != "" {
+		return s.Alias
+	}
+
+	return strings.Trim(nonHostnameChars.ReplaceAllString(strings.ToLower(s.Name), "-"), "-")
+}
+
+type ServicePort struct {
+	// Name is the name of parameter to expose assigned host port.
+	Name string `json:"name"`
+	// Port is the container port.
+	Port string `json:"port"`
+	// Bind is the host address to bind port on, defaults to scenario bind address.
+	Bind string `json:"bind,omitempty"`
+	// Base is the base host port, if set host port is base plus team index.
+	Base int `json:"base,omitempty"`
+}
+
+// Port returns service port by its name or container port.
+func (s *Service) Port(name string) *ServicePort {
+	for i, p := range s.Ports {
+		if p.Name == name || p.Port == name {
+			return &s.Ports[i]
+		}
+	}
+
+	return nil
+}
+
+type ReadinessType string
+
+const (
+	ReadinessTypeTCP  ReadinessType = "tcp"
+	ReadinessTypeHTTP ReadinessType = "http"
+	ReadinessTypeLog  ReadinessType = "log"
+	ReadinessTypeExec ReadinessType = "exec"
+)
+
+const (
+	DefaultReadinessTimeout  = 30 * time.Second
+	DefaultReadinessInterval = time.Second
+)
+
+// Readiness is a check that must pass before service is considered ready.
+type Readiness struct {
+	// Type is the type of the check.
+	Type ReadinessType `json:"type"`
+	// Port is the service port name or container port to check for tcp and http checks.
+	Port string `json:"port,omitempty"`
+	// Path is the HTTP path to request for http checks.
+	Path string `json:"path,omitempty"`
+	// Regexp is the regular expression to match in service logs for log checks.
+	Regexp string `json:"regexp,omitempty"`
+	// Command is the command to execute in service container for exec checks.
+	Command string `json:"command,omitempty"`
+	// Timeout is the maximum time to wait for the check to pass.
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// Interval is the time to wait between check attempts.
+	Interval time.Duration `json:"interval,omitempty"`
+}
+
+// Interaction is a single command sent to a caught shell.
+type Interaction struct {
+	// Send is the command line to send to the shell.
+	Send string `json:"send,omitempty"`
+	// Expect is the regular expression to wait for in the shell output.
+	Expect string `json:"expect,omitempty"`
+	// Capture is the evidence name to store the first capture group or whole match of expect regexp.
+	Capture string `json:"capture,omitempty"`
+	// Timeout is the maximum time to wait for expected output.
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
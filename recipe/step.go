@@ -6,6 +6,9 @@ package recipe
 import (
 	"fmt"
 	"strconv"
+	"time"
+
+	"vilks.io/vilks/template"
 )
 
 type EvidenceType string
@@ -22,8 +25,16 @@ type Evidence struct {
 	Regexp string       `json:"regexp,omitempty"`
 }
 
-type When struct {
-	Status string `json:"status"`
+const DefaultWaitTimeout = time.Minute
+
+// Wait waits for service output to match regular expression after step commands are executed.
+type Wait struct {
+	// Service is the name of the service to watch.
+	Service string `json:"service"`
+	// Regexp is the regular expression to match in service output.
+	Regexp string `json:"regexp"`
+	// Timeout is the maximum time to wait for the match.
+	Timeout time.Duration `json:"timeout,omitempty"`
 }
 
 type Conditions struct {
@@ -33,22 +44,77 @@ type Conditions struct {
 
 type Step struct {
 	Name        string         `json:"name"`
+	ID          string         `json:"id,omitempty"`
 	Image       string         `json:"image"`
 	Environment map[string]any `json:"environment"`
 	Conditions  *Conditions    `json:"conditions,omitempty"`
-	Commands    []string       `json:"commands"`
+	Commands    []*Command     `json:"commands"`
 	Evidence    []Evidence     `json:"evidence"`
+	Outputs     []Output       `json:"outputs,omitempty"`
 	When        *When          `json:"when,omitempty"`
+	Wait        *Wait          `json:"wait,omitempty"`
+	Foreach     *Foreach       `json:"foreach,omitempty"`
+	Matrix      *Matrix        `json:"matrix,omitempty"`
+	Resources   *Resources     `json:"resources,omitempty"`
+	Security    `json:",inline"`
+}
+
+// Ref returns step identifier its outputs and results are referenced by,
+// step name is used when identifier is not set.
+func (s *Step) Ref() string {
+	if s.ID != "" {
+		return s.ID
+	}
+
+	return s.Name
+}
+
+// templates returns step values parameters are substituted in.
+func (s *Step) templates() []string {
+	var t []string
+
+	for _, c := range s.Commands {
+		t = append(t, c.Run)
+
+		if c.Stdin != nil {
+			t = append(t, c.Stdin.Data)
+		}
+	}
+
+	for _, v := range s.Environment {
+		if v, ok := v.(string); ok {
+			t = append(t, v)
+		}
+	}
+
+	if s.Foreach != nil {
+		t = append(t, s.Foreach.Items...)
+	}
+
+	if s.Matrix != nil {
+		for _, items := range s.Matrix.Params {
+			t = append(t, items...)
+		}
+	}
+
+	if s.Wait != nil {
+		t = append(t, s.Wait.Regexp)
+	}
+
+	return t
 }
 
-func (s *Step) Environ(params map[string]string) []string {
+func (s *Step) Environ(params map[string]string) ([]string, error) {
 	env := make([]string, 0, len(s.Environment))
 
 	for k, v := range s.Environment {
 		var val string
 		switch v := v.(type) {
 		case string:
-			val = v
+			var err error
+			if val, err = template.Expand(v, params); err != nil {
+				return nil, fmt.Errorf("environment variable '%s': %w", k, err)
+			}
 		case int, int32, int64:
 			val = fmt.Sprintf("%d", v)
 		case bool:
@@ -56,14 +122,14 @@ func (s *Step) Environ(params map[string]string) []string {
 		case float32, float64:
 			val = fmt.Sprintf("%f", v)
 		case map[string]any:
-			if prm, ok := v["from_param"]; ok {
-				if v, ok := prm.(string); ok {
-					val = params[v]
-				}
-			}
+			name, prefix := v["from_param"], ""
 			if prm, ok := v["from_evidence"]; ok {
-				if v, ok := prm.(string); ok {
-					val = params["evidence_"+v]
+				name, prefix = prm, "evidence_"
+			}
+
+			if n, ok := name.(string); ok {
+				if val, ok = template.Lookup(params, prefix+n); !ok {
+					return nil, fmt.Errorf("environment variable '%s' references undefined parameter '%s'", k, prefix+n)
 				}
 			}
 		}
@@ -71,17 +137,5 @@ func (s *Step) Environ(params map[string]string) []string {
 		env = append(env, fmt.Sprintf("%s=%s", k, val))
 	}
 
-	return env
-}
-
-type Service struct {
-	Name    string        `json:"name"`
-	Image   string        `json:"image"`
-	Command string        `json:"command"`
-	Ports   []ServicePort `json:"ports"`
-}
-
-type ServicePort struct {
-	Name string `json:"name"`
-	Port string `json:"port"`
+	return env, nil
 }
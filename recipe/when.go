@@ -0,0 +1,188 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package recipe
+
+import (
+	"fmt"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/vm"
+	"github.com/goccy/go-yaml"
+)
+
+const (
+	StepStatusSuccess = "success"
+	StepStatusFailure = "failure"
+	StepStatusSkipped = "skipped"
+	StepStatusPending = "pending"
+)
+
+// When is the step execution condition. It can be specified as a plain expression string.
+type When struct {
+	// Status is the attack status required to execute step, success or failure.
+	Status string `json:"status,omitempty"`
+	// Expr is the expression that must evaluate to true to execute step. After a step
+	// has failed expression is evaluated only if it references failed or status.
+	Expr string `json:"expr,omitempty"`
+
+	program *vm.Program
+	// onFailure is set if expression references attack status and handles failures itself.
+	onFailure bool
+}
+
+func (w *When) UnmarshalYAML(data []byte) error {
+	var e string
+	if err := yaml.Unmarshal(data, &e); err == nil {
+		w.Expr = e
+
+		return nil
+	}
+
+	type plain When
+
+	return yaml.Unmarshal(data, (*plain)(w))
+}
+
+// StepResult is the result of executed step available in expressions.
+type StepResult struct {
+	// Status is the step status, success, failure, skipped or pending.
+	Status string `expr:"status"`
+	// ExitCode is the exit code of the last executed step command.
+	ExitCode int `expr:"exit_code"`
+	// Outputs are the step output values.
+	Outputs map[string]string `expr:"outputs"`
+}
+
+// WhenEnv is the environment step conditions are evaluated in.
+type WhenEnv struct {
+	// Status is the attack status so far, success or failure.
+	Status string `expr:"status"`
+	// Failed is a flag indicating if any of previous steps has failed.
+	Failed bool `expr:"failed"`
+	// Params are the step parameters.
+	Params map[string]string `expr:"params"`
+	// Evidence are the evidence values collected so far.
+	Evidence map[string]string `expr:"evidence"`
+	// Steps are the results of previous steps by id or name.
+	Steps map[string]*StepResult `expr:"steps"`
+}
+
+// Compile parses and type checks condition expression.
+func (w *When) Compile() error {
+	switch w.Status {
+	case "", StepStatusSuccess, StepStatusFailure:
+	default:
+		return fmt.Errorf("invalid status '%s'", w.Status)
+	}
+
+	if w.Expr == "" || w.program != nil {
+		return nil
+	}
+
+	p, err := expr.Compile(w.Expr, expr.Env(WhenEnv{}), expr.AsBool())
+	if err != nil {
+		return fmt.Errorf("invalid expression '%s': %w", w.Expr, err)
+	}
+
+	var refs statusRefs
+
+	node := p.Node()
+	ast.Walk(&node, &refs)
+
+	w.program, w.onFailure = p, bool(refs)
+
+	return nil
+}
+
+// statusRefs is set if expression references failed or status variables.
+type statusRefs bool
+
+func (v *statusRefs) Visit(node *ast.Node) {
+	if id, ok := (*node).(*ast.IdentifierNode); ok && (id.Value == "failed" || id.Value == "status") {
+		*v = true
+	}
+}
+
+// stepRefs collects names of steps referenced in expression.
+type stepRefs []string
+
+func (v *stepRefs) Visit(node *ast.Node) {
+	m, ok := (*node).(*ast.MemberNode)
+	if !ok {
+		return
+	}
+
+	if id, ok := m.Node.(*ast.IdentifierNode); !ok || id.Value != "steps" {
+		return
+	}
+
+	if name, ok := m.Property.(*ast.StringNode); ok {
+		*v = append(*v, name.Value)
+	}
+}
+
+// ValidateConditions type checks step conditions and makes sure they reference
+// only steps defined before them.
+func (r *Recipe) ValidateConditions() error {
+	seen := make(map[string]bool, len(r.Steps))
+
+	for _, step := range r.Steps {
+		if step.When != nil {
+			if err := step.When.Compile(); err != nil {
+				return fmt.Errorf("step '%s' condition: %w", step.Name, err)
+			}
+
+			if step.When.program != nil {
+				var refs stepRefs
+
+				node := step.When.program.Node()
+				ast.Walk(&node, &refs)
+
+				for _, name := range refs {
+					if !seen[name] {
+						return fmt.Errorf("step '%s' condition references unknown or later step '%s'", step.Name, name)
+					}
+				}
+			}
+		}
+
+		seen[step.Ref()] = true
+	}
+
+	return nil
+}
+
+// Match returns true if step should be executed. Without condition steps are
+// executed only while no previous step has failed. Status condition selects
+// the attack status step is executed in. Expression is evaluated only while
+// no previous step has failed unless status is set or expression references
+// failed or status, e.g. "failed && steps.scan.exit_code == 2".
+func (w *When) Match(env *WhenEnv) (bool, error) {
+	if w == nil {
+		return !env.Failed, nil
+	}
+
+	if err := w.Compile(); err != nil {
+		return false, err
+	}
+
+	switch {
+	case w.Status == StepStatusFailure && !env.Failed,
+		w.Status == StepStatusSuccess && env.Failed,
+		w.Status == "" && !w.onFailure && env.Failed:
+		return false, nil
+	case w.program == nil:
+		return true, nil
+	}
+
+	res, err := expr.Run(w.program, env)
+	if err != nil {
+		return false, fmt.Errorf("failed to evaluate expression '%s': %w", w.Expr, err)
+	}
+
+	ok, _ := res.(bool)
+
+	return ok, nil
+}
@@ -0,0 +1,183 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package recipe
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+)
+
+func TestWhenUnmarshal(t *testing.T) {
+	var steps []struct {
+		When *When `json:"when"`
+	}
+
+	if err := yaml.Unmarshal([]byte(`
+- when: steps.scan.exit_code == 0
+- when:
+    status: failure
+    expr: params.mode == "full"
+`), &steps); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := steps[0].When; w.Expr != "steps.scan.exit_code == 0" || w.Status != "" {
+		t.Errorf("plain expression = %+v", w)
+	}
+
+	if w := steps[1].When; w.Expr != `params.mode == "full"` || w.Status != StepStatusFailure {
+		t.Errorf("condition = %+v", w)
+	}
+}
+
+func TestWhenMatch(t *testing.T) {
+	env := func(failed bool) *WhenEnv {
+		status := StepStatusSuccess
+		if failed {
+			status = StepStatusFailure
+		}
+
+		return &WhenEnv{
+			Status:   status,
+			Failed:   failed,
+			Params:   map[string]string{"mode": "full"},
+			Evidence: map[string]string{"user": "admin"},
+			Steps: map[string]*StepResult{
+				"scan": {Status: StepStatusFailure, ExitCode: 2, Outputs: map[string]string{"port": "8080"}},
+				"skip": {Status: StepStatusSkipped},
+			},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		when   *When
+		failed bool
+		want   bool
+	}{
+		{name: "no condition", want: true},
+		{name: "no condition after failure", failed: true},
+		{name: "success status", when: &When{Status: StepStatusSuccess}, want: true},
+		{name: "success status after failure", when: &When{Status: StepStatusSuccess}, failed: true},
+		{name: "failure status", when: &When{Status: StepStatusFailure}},
+		{name: "failure status after failure", when: &When{Status: StepStatusFailure}, failed: true, want: true},
+		{name: "params", when: &When{Expr: `params.mode == "full"`}, want: true},
+		{name: "evidence", when: &When{Expr: `evidence.user == "root"`}},
+		{name: "step exit code", when: &When{Expr: "steps.scan.exit_code == 2"}, want: true},
+		{name: "step output", when: &When{Expr: `steps["scan"].outputs.port == "8080"`}, want: true},
+		{name: "step status", when: &When{Expr: `steps.skip.status == "skipped"`}, want: true},
+		{name: "expression after failure", when: &When{Expr: "steps.scan.exit_code == 2"}, failed: true},
+		{name: "failed reference", when: &When{Expr: "failed && steps.scan.exit_code == 2"}, failed: true, want: true},
+		{name: "status reference", when: &When{Expr: `status == "failure"`}, failed: true, want: true},
+		{name: "status reference before failure", when: &When{Expr: `status == "failure"`}},
+		{name: "status and expression", when: &When{Status: StepStatusFailure, Expr: "steps.scan.exit_code == 2"}, failed: true, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.when.Match(env(tt.failed))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("match = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWhenCompile(t *testing.T) {
+	tests := []struct {
+		name string
+		when When
+		err  string
+	}{
+		{name: "valid", when: When{Status: StepStatusFailure, Expr: "failed"}},
+		{name: "invalid status", when: When{Status: "done"}, err: "invalid status 'done'"},
+		{name: "syntax error", when: When{Expr: "steps.scan.exit_code =="}, err: "invalid expression"},
+		{name: "unknown variable", when: When{Expr: "target == 1"}, err: "invalid expression"},
+		{name: "not boolean", when: When{Expr: "params.mode"}, err: "invalid expression"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.when.Compile()
+
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestValidateConditions(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []*Step
+		err   string
+	}{
+		{
+			name: "earlier step",
+			steps: []*Step{
+				{Name: "scan"},
+				{Name: "exploit", When: &When{Expr: "steps.scan.exit_code == 0"}},
+			},
+		},
+		{
+			name: "step id",
+			steps: []*Step{
+				{Name: "Port scan", ID: "scan"},
+				{Name: "exploit", When: &When{Expr: `steps["scan"].status == "success"`}},
+			},
+		},
+		{
+			name: "unknown step",
+			steps: []*Step{
+				{Name: "exploit", When: &When{Expr: "steps.scan.exit_code == 0"}},
+			},
+			err: "step 'exploit' condition references unknown or later step 'scan'",
+		},
+		{
+			name: "later step",
+			steps: []*Step{
+				{Name: "exploit", When: &When{Expr: "steps.scan.exit_code == 0"}},
+				{Name: "scan"},
+			},
+			err: "references unknown or later step 'scan'",
+		},
+		{
+			name: "self reference",
+			steps: []*Step{
+				{Name: "scan", When: &When{Expr: `steps.scan.status == "pending"`}},
+			},
+			err: "references unknown or later step 'scan'",
+		},
+		{
+			name: "compile error",
+			steps: []*Step{
+				{Name: "scan", When: &When{Expr: "steps.scan.exit_code +"}},
+			},
+			err: "step 'scan' condition: invalid expression",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&Recipe{Steps: tt.steps}).ValidateConditions()
+
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
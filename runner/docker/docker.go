@@ -16,6 +16,7 @@ import (
 
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
 	"github.com/docker/go-connections/nat"
 	"github.com/moby/moby/client"
 	"github.com/moby/moby/pkg/stdcopy"
@@ -45,12 +46,16 @@ var (
 	}
 )
 
+// exitCodeKilled is the exit code of process killed by SIGKILL.
+const exitCodeKilled = 137
+
 var ErrContainerNotStarted = errors.New("container not started")
 
 type impl struct {
 	containerID        string
 	volumeName         string
 	evidenceVolumeName string
+	firewallRules      []FirewallRule
 	client             *client.Client
 }
 
@@ -101,18 +106,57 @@ func (d *impl) Start(ctx context.Context, cmd runner.StartOptions) error {
 		return err
 	}
 
+	shell := cmd.Shell
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+
 	entrypoint := cmd.Entrypoint
 	if !cmd.Plugin && !cmd.Service && len(entrypoint) == 0 {
-		entrypoint = []string{cmd.Shell, "-c", fmt.Sprintf("sleep %d", int(cmd.Timeout.Seconds()))}
+		entrypoint = []string{shell, "-c", fmt.Sprintf("sleep %d", int(cmd.Timeout.Seconds()))}
+	}
+
+	if cmd.RestrictEgress {
+		if len(entrypoint) == 0 {
+			return errors.New("egress can be restricted only for containers with entrypoint")
+		}
+
+		// Entrypoint must not run before egress firewall rules are in place.
+		entrypoint = gateEntrypoint(shell, entrypoint)
 	}
 
 	containerConfig := &container.Config{
 		Image:      cmd.Image,
 		Env:        nil,
 		Entrypoint: entrypoint,
+		Labels:     cmd.Labels,
+		User:       cmd.User,
+	}
+
+	hostConfig := &container.HostConfig{
+		CapAdd:         cmd.CapAdd,
+		CapDrop:        cmd.CapDrop,
+		Privileged:     cmd.Privileged,
+		ReadonlyRootfs: cmd.ReadOnly,
+		SecurityOpt:    cmd.SecurityOpt,
+	}
+	if res := cmd.Resources; res != nil {
+		hostConfig.NanoCPUs = res.NanoCPUs
+		hostConfig.Memory = res.Memory
+
+		if res.PidsLimit > 0 {
+			hostConfig.PidsLimit = &res.PidsLimit
+		}
+
+		for _, u := range res.Ulimits {
+			hostConfig.Ulimits = append(hostConfig.Ulimits, &container.Ulimit{
+				Name: u.Name,
+				Soft: u.Soft,
+				Hard: u.Hard,
+			})
+		}
 	}
 
-	hostConfig := &container.HostConfig{}
 	if d.volumeName != "" {
 		hostConfig.Binds = append(hostConfig.Binds, fmt.Sprintf("%s:%s", d.volumeName, wordspaceDir))
 	}
@@ -137,7 +181,18 @@ func (d *impl) Start(ctx context.Context, cmd runner.StartOptions) error {
 		}
 	}
 
-	resp, err := d.client.ContainerCreate(ctx, containerConfig, hostConfig, nil, nil, "")
+	var networkConfig *network.NetworkingConfig
+
+	if len(cmd.Networks) > 0 {
+		hostConfig.NetworkMode = container.NetworkMode(cmd.Networks[0].Name)
+		networkConfig = &network.NetworkingConfig{
+			EndpointsConfig: map[string]*network.EndpointSettings{
+				cmd.Networks[0].Name: endpointSettings(cmd.Networks[0]),
+			},
+		}
+	}
+
+	resp, err := d.client.ContainerCreate(ctx, containerConfig, hostConfig, networkConfig, nil, "")
 	if client.IsErrNotFound(err) {
 		var r io.ReadCloser
 
@@ -150,7 +205,7 @@ func (d *impl) Start(ctx context.Context, cmd runner.StartOptions) error {
 		_, _ = io.ReadAll(r)
 		r.Close()
 
-		resp, err = d.client.ContainerCreate(ctx, containerConfig, hostConfig, nil, nil, "")
+		resp, err = d.client.ContainerCreate(ctx, containerConfig, hostConfig, networkConfig, nil, "")
 	}
 
 	if err != nil {
@@ -159,7 +214,44 @@ func (d *impl) Start(ctx context.Context, cmd runner.StartOptions) error {
 
 	d.containerID = resp.ID
 
-	return d.client.ContainerStart(ctx, d.containerID, startOpts)
+	for _, n := range cmd.Networks[min(1, len(cmd.Networks)):] {
+		if err := d.client.NetworkConnect(ctx, n.Name, d.containerID, endpointSettings(n)); err != nil {
+			return err
+		}
+	}
+
+	if err := d.client.ContainerStart(ctx, d.containerID, startOpts); err != nil {
+		return err
+	}
+
+	if cmd.RestrictEgress {
+		err := d.restrictEgress(ctx, cmd.Egress)
+		if err == nil {
+			err = d.openEgressGate(ctx, shell)
+		}
+
+		if err != nil {
+			_ = d.Stop(context.WithoutCancel(ctx))
+
+			return fmt.Errorf("failed to restrict container egress: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func endpointSettings(n runner.NetworkAttachment) *network.EndpointSettings {
+	es := &network.EndpointSettings{
+		Aliases: n.Aliases,
+	}
+
+	if n.IPAddress != "" {
+		es.IPAMConfig = &network.EndpointIPAMConfig{
+			IPv4Address: n.IPAddress,
+		}
+	}
+
+	return es
 }
 
 func (d *impl) Tail(ctx context.Context) (io.ReadCloser, error) {
@@ -189,6 +281,25 @@ func (d *impl) Tail(ctx context.Context) (io.ReadCloser, error) {
 }
 
 func (d *impl) Exec(ctx context.Context, env []string, cmd string, args ...string) (*runner.ExecResult, error) {
+	var outBuf, errBuf bytes.Buffer
+
+	res, err := d.ExecStream(ctx, runner.ExecOptions{
+		Env:    env,
+		Cmd:    append([]string{cmd}, args...),
+		Stdout: &outBuf,
+		Stderr: &errBuf,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res.Stdout = outBuf.Bytes()
+	res.Stderr = errBuf.Bytes()
+
+	return res, nil
+}
+
+func (d *impl) ExecStream(ctx context.Context, opts runner.ExecOptions) (*runner.ExecResult, error) {
 	if d.containerID == "" {
 		return nil, ErrContainerNotStarted
 	}
@@ -199,12 +310,20 @@ func (d *impl) Exec(ctx context.Context, env []string, cmd string, args ...strin
 
 	consoleSize := [2]uint{20, 80}
 
+	// Container OOM killed state is not reset so it must be compared with state before command.
+	oomKilledBefore, err := d.oomKilled(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	exec, err := d.client.ContainerExecCreate(ctx, d.containerID, container.ExecOptions{
+		AttachStdin:  opts.Stdin != nil,
 		AttachStdout: true,
 		AttachStderr: true,
+		Tty:          opts.TTY,
 		WorkingDir:   wordspaceDir,
-		Env:          env,
-		Cmd:          append([]string{cmd}, args...),
+		Env:          opts.Env,
+		Cmd:          opts.Cmd,
 	})
 	if err != nil {
 		return nil, err
@@ -212,7 +331,7 @@ func (d *impl) Exec(ctx context.Context, env []string, cmd string, args ...strin
 
 	resp, err := d.client.ContainerExecAttach(ctx, exec.ID, container.ExecStartOptions{
 		Detach:      false,
-		Tty:         false,
+		Tty:         opts.TTY,
 		ConsoleSize: &consoleSize,
 	})
 	if err != nil {
@@ -220,14 +339,43 @@ func (d *impl) Exec(ctx context.Context, env []string, cmd string, args ...strin
 	}
 	defer resp.Close()
 
-	// Read the command output
-	var outBuf, errBuf bytes.Buffer
+	if opts.Stdin != nil {
+		go func() {
+			_, _ = io.Copy(resp.Conn, opts.Stdin)
+
+			if opts.TTY {
+				// Send end of transmission as terminal does not propagate closed input.
+				_, _ = resp.Conn.Write([]byte{4})
+
+				return
+			}
+
+			_ = resp.CloseWrite()
+		}()
+	}
 
-	outputDone := make(chan error)
+	stdout, stderr := opts.Stdout, opts.Stderr
+	if stdout == nil {
+		stdout = io.Discard
+	}
+
+	if stderr == nil {
+		stderr = io.Discard
+	}
+
+	outputDone := make(chan error, 1)
 
 	go func() {
-		// StdCopy demultiplexes the stream into two buffers
-		_, err = stdcopy.StdCopy(&outBuf, &errBuf, resp.Reader)
+		if opts.TTY {
+			// Output is not multiplexed when terminal is attached
+			_, err := io.Copy(stdout, resp.Reader)
+			outputDone <- err
+
+			return
+		}
+
+		// StdCopy demultiplexes the stream into two writers
+		_, err := stdcopy.StdCopy(stdout, stderr, resp.Reader)
 		outputDone <- err
 	}()
 
@@ -236,34 +384,42 @@ func (d *impl) Exec(ctx context.Context, env []string, cmd string, args ...strin
 		if err != nil {
 			return nil, err
 		}
-
-		break
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	}
 
-	stdout, err := io.ReadAll(&outBuf)
+	res, err := d.client.ContainerExecInspect(ctx, exec.ID)
 	if err != nil {
 		return nil, err
 	}
 
-	stderr, err := io.ReadAll(&errBuf)
-	if err != nil {
-		return nil, err
-	}
+	var oomKilled bool
 
-	res, err := d.client.ContainerExecInspect(ctx, exec.ID)
-	if err != nil {
-		return nil, err
+	if res.ExitCode != 0 {
+		if oomKilled, err = d.oomKilled(ctx); err != nil {
+			return nil, err
+		}
+
+		// Process killed by OOM killer exits with SIGKILL status.
+		oomKilled = oomKilled && (!oomKilledBefore || res.ExitCode == exitCodeKilled)
 	}
 
 	return &runner.ExecResult{
-		Stdout:   stdout,
-		Stderr:   stderr,
-		ExitCode: res.ExitCode,
+		ExitCode:  res.ExitCode,
+		OOMKilled: oomKilled,
 	}, nil
 }
 
+// oomKilled returns if any process in container has been killed by OOM killer.
+func (d *impl) oomKilled(ctx context.Context) (bool, error) {
+	info, err := d.client.ContainerInspect(ctx, d.containerID)
+	if err != nil {
+		return false, err
+	}
+
+	return info.State != nil && info.State.OOMKilled, nil
+}
+
 func (d *impl) DownlaodEvidence(ctx context.Context, path string) (io.ReadCloser, error) {
 	if d.containerID == "" {
 		return nil, ErrContainerNotStarted
@@ -283,6 +439,12 @@ func (d *impl) DownlaodEvidence(ctx context.Context, path string) (io.ReadCloser
 }
 
 func (d *impl) Stop(ctx context.Context) error {
+	// Remove firewall rules even if it fails to not leave container running.
+	var firewallErr error
+	if len(d.firewallRules) > 0 {
+		firewallErr = d.removeEgress(ctx)
+	}
+
 	if d.containerID != "" {
 		if err := d.client.ContainerKill(ctx, d.containerID, "9"); err != nil && !isErrContainerNotFoundOrNotRunning(err) {
 			return err
@@ -305,7 +467,7 @@ func (d *impl) Stop(ctx context.Context) error {
 		}
 	}
 
-	return nil
+	return firewallErr
 }
 
 func isErrContainerNotFoundOrNotRunning(err error) bool {
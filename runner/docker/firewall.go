@@ -0,0 +1,266 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"vilks.io/vilks/runner"
+
+	"github.com/docker/docker/api/types/network"
+)
+
+// firewallChain is the iptables chain Docker evaluates before its own forwarding rules.
+const firewallChain = "DOCKER-USER"
+
+// firewallComment is the prefix of comment added to firewall rules followed by container ID.
+const firewallComment = "vilks:"
+
+// multiportMax is the maximum number of ports in a single multiport match,
+// port range counts as two ports.
+const multiportMax = 15
+
+// egressGate is the file entrypoint of container with restricted egress waits
+// for, it is created once firewall rules of the container are in place.
+const egressGate = "/dev/shm/.vilks-egress"
+
+var ErrNoContainerAddress = errors.New("container has no IP address to restrict egress")
+
+// FirewallRule is an egress firewall rule of a container.
+type FirewallRule struct {
+	// ContainerID is the short ID of the container rule belongs to.
+	ContainerID string
+	// Command is the iptables or ip6tables command the rule is managed with.
+	Command string
+	// Spec is the rule specification without chain.
+	Spec []string
+}
+
+func (r FirewallRule) String() string {
+	return r.Command + " " + strings.Join(r.Spec, " ")
+}
+
+// restrictEgress inserts firewall rules that allow container to connect only
+// to destinations allowed by rules and to other containers in networks created
+// by vilks. Rules are added for both IPv4 and IPv6 container addresses.
+func (d *impl) restrictEgress(ctx context.Context, rules []runner.EgressRule) error {
+	info, err := d.client.ContainerInspect(ctx, d.containerID)
+	if err != nil {
+		return err
+	}
+
+	var ips []string
+
+	allowed := append([]runner.EgressRule{}, rules...)
+
+	for _, ep := range info.NetworkSettings.Networks {
+		for _, ip := range []string{ep.IPAddress, ep.GlobalIPv6Address} {
+			if ip != "" {
+				ips = append(ips, ip)
+			}
+		}
+
+		if ep.IPAddress == "" && ep.GlobalIPv6Address == "" {
+			continue
+		}
+
+		n, err := d.client.NetworkInspect(ctx, ep.NetworkID, network.InspectOptions{})
+		if err != nil {
+			return err
+		}
+
+		if _, ok := n.Labels[runner.LabelRunID]; !ok {
+			continue
+		}
+
+		for _, c := range n.IPAM.Config {
+			allowed = append(allowed, runner.EgressRule{Network: c.Subnet})
+		}
+	}
+
+	if len(ips) == 0 {
+		return ErrNoContainerAddress
+	}
+
+	id := d.containerID[:12]
+	comment := []string{"-m", "comment", "--comment", firewallComment + id}
+
+	for _, ip := range ips {
+		v6 := isIPv6(ip)
+
+		cmd := "iptables"
+		if v6 {
+			cmd = "ip6tables"
+		}
+
+		specs := [][]string{
+			{"-s", ip, "-j", "DROP"},
+			{"-s", ip, "-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-j", "ACCEPT"},
+		}
+
+		for _, r := range allowed {
+			if isIPv6(r.Network) != v6 {
+				continue
+			}
+
+			if len(r.Ports) == 0 {
+				specs = append(specs, []string{"-s", ip, "-d", r.Network, "-j", "ACCEPT"})
+
+				continue
+			}
+
+			for _, ports := range multiportChunks(r.Ports) {
+				for _, proto := range []string{"tcp", "udp"} {
+					specs = append(specs, []string{"-s", ip, "-d", r.Network, "-p", proto, "-m", "multiport", "--dports", ports, "-j", "ACCEPT"})
+				}
+			}
+		}
+
+		// Rules are inserted at the top of the chain so drop rule must be inserted first.
+		for _, spec := range specs {
+			rule := FirewallRule{ContainerID: id, Command: cmd, Spec: append(spec, comment...)}
+
+			if err := firewall(ctx, rule.Command, append([]string{"-I", firewallChain}, rule.Spec...)...); err != nil {
+				_ = d.removeEgress(ctx)
+
+				return err
+			}
+
+			d.firewallRules = append(d.firewallRules, rule)
+		}
+	}
+
+	return nil
+}
+
+// gateEntrypoint wraps container entrypoint to wait until egress firewall rules
+// are in place, as container address is known only after it is started.
+func gateEntrypoint(shell string, entrypoint []string) []string {
+	script := "while [ ! -e " + egressGate + ` ]; do sleep 0.1; done; exec "$@"`
+
+	return append([]string{shell, "-c", script, "vilks-gate"}, entrypoint...)
+}
+
+// openEgressGate releases container entrypoint waiting for egress firewall rules.
+func (d *impl) openEgressGate(ctx context.Context, shell string) error {
+	res, err := d.Exec(ctx, nil, shell, "-c", ": > "+egressGate)
+	if err != nil {
+		return err
+	}
+
+	if res.ExitCode != 0 {
+		return fmt.Errorf("failed to release container entrypoint: %s", strings.TrimSpace(string(res.Stderr)))
+	}
+
+	return nil
+}
+
+func (d *impl) removeEgress(ctx context.Context) error {
+	var errs []error
+
+	for _, rule := range d.firewallRules {
+		if err := RemoveFirewallRule(ctx, rule); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	d.firewallRules = nil
+
+	return errors.Join(errs...)
+}
+
+// isIPv6 checks if address or network is IPv6.
+func isIPv6(addr string) bool {
+	return strings.Contains(addr, ":")
+}
+
+// multiportChunks splits ports into multiport match lists that do not exceed
+// the multiport match limit.
+func multiportChunks(ports []string) []string {
+	var (
+		chunks []string
+		chunk  []string
+		n      int
+	)
+
+	for _, p := range ports {
+		w := 1
+		if strings.Contains(p, "-") {
+			w = 2
+		}
+
+		if n+w > multiportMax {
+			chunks = append(chunks, strings.Join(chunk, ","))
+			chunk, n = nil, 0
+		}
+
+		chunk = append(chunk, strings.ReplaceAll(p, "-", ":"))
+		n += w
+	}
+
+	if len(chunk) > 0 {
+		chunks = append(chunks, strings.Join(chunk, ","))
+	}
+
+	return chunks
+}
+
+// FirewallRules returns egress firewall rules added by vilks.
+func FirewallRules(ctx context.Context) ([]FirewallRule, error) {
+	var rules []FirewallRule
+
+	for _, cmd := range []string{"iptables", "ip6tables"} {
+		out, err := exec.CommandContext(ctx, cmd, "-S", firewallChain).Output()
+		if err != nil {
+			var eerr *exec.ExitError
+			if cmd == "ip6tables" && (errors.Is(err, exec.ErrNotFound) || errors.As(err, &eerr)) {
+				// IPv6 firewall is not available.
+				continue
+			}
+
+			return nil, fmt.Errorf("%s -S %s: %w", cmd, firewallChain, err)
+		}
+
+		for _, line := range strings.Split(string(out), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) < 3 || fields[0] != "-A" || fields[1] != firewallChain {
+				continue
+			}
+
+			spec := fields[2:]
+
+			for i, f := range spec {
+				spec[i] = strings.Trim(f, `"`)
+
+				if i > 0 && spec[i-1] == "--comment" && strings.HasPrefix(spec[i], firewallComment) {
+					rules = append(rules, FirewallRule{
+						ContainerID: strings.TrimPrefix(spec[i], firewallComment),
+						Command:     cmd,
+						Spec:        spec,
+					})
+				}
+			}
+		}
+	}
+
+	return rules, nil
+}
+
+// RemoveFirewallRule removes egress firewall rule.
+func RemoveFirewallRule(ctx context.Context, rule FirewallRule) error {
+	return firewall(ctx, rule.Command, append([]string{"-D", firewallChain}, rule.Spec...)...)
+}
+
+func firewall(ctx context.Context, cmd string, args ...string) error {
+	out, err := exec.CommandContext(ctx, cmd, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %w: %s", cmd, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package docker
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"vilks.io/vilks/runner"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/moby/moby/client"
+)
+
+const (
+	// ResourceKindContainer is the kind of container resources.
+	ResourceKindContainer = "container"
+	// ResourceKindNetwork is the kind of network resources.
+	ResourceKindNetwork = "network"
+)
+
+// ListResources lists all containers and networks created by vilks runs.
+func ListResources(ctx context.Context) ([]runner.Resource, error) {
+	c, err := client.NewClientWithOpts()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	containers, err := c.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", runner.LabelRunID)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	networks, err := c.NetworkList(ctx, network.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", runner.LabelRunID)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]runner.Resource, 0, len(containers)+len(networks))
+
+	for _, ct := range containers {
+		var name string
+		if len(ct.Names) > 0 {
+			name = ct.Names[0]
+		}
+
+		res = append(res, runner.Resource{
+			ID:      ct.ID,
+			Kind:    ResourceKindContainer,
+			Name:    name,
+			Created: time.Unix(ct.Created, 0),
+			Labels:  ct.Labels,
+		})
+	}
+
+	// Networks must be removed after containers that are connected to them.
+	for _, n := range networks {
+		res = append(res, runner.Resource{
+			ID:      n.ID,
+			Kind:    ResourceKindNetwork,
+			Name:    n.Name,
+			Created: n.Created,
+			Labels:  n.Labels,
+		})
+	}
+
+	return res, nil
+}
+
+// RemoveResource forcibly removes resource created by vilks run.
+func RemoveResource(ctx context.Context, res runner.Resource) error {
+	c, err := client.NewClientWithOpts()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if res.Kind == ResourceKindNetwork {
+		return RemoveNetwork(ctx, res.ID)
+	}
+
+	err = c.ContainerRemove(ctx, res.ID, container.RemoveOptions{
+		RemoveVolumes: true,
+		Force:         true,
+	})
+	if err != nil && !isErrContainerNotFoundOrNotRunning(err) {
+		return err
+	}
+
+	return nil
+}
+
+// StaleFirewallRules lists egress firewall rules of containers that no longer exist.
+func StaleFirewallRules(ctx context.Context) ([]FirewallRule, error) {
+	rules, err := FirewallRules(ctx)
+	if err != nil || len(rules) == 0 {
+		return nil, err
+	}
+
+	c, err := client.NewClientWithOpts()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	stale := make([]FirewallRule, 0, len(rules))
+
+	for _, r := range rules {
+		_, err := c.ContainerInspect(ctx, r.ContainerID)
+		if err == nil {
+			continue
+		}
+
+		if !strings.Contains(err.Error(), "No such container") {
+			return nil, err
+		}
+
+		stale = append(stale, r)
+	}
+
+	return stale, nil
+}
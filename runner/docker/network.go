@@ -0,0 +1,46 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package docker
+
+import (
+	"context"
+	"strings"
+
+	"github.com/docker/docker/api/types/network"
+	"github.com/moby/moby/client"
+)
+
+// CreateNetwork creates user-defined bridge network and returns its ID.
+func CreateNetwork(ctx context.Context, name string, labels map[string]string) (string, error) {
+	c, err := client.NewClientWithOpts()
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+
+	resp, err := c.NetworkCreate(ctx, name, network.CreateOptions{
+		Driver: "bridge",
+		Labels: labels,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return resp.ID, nil
+}
+
+// RemoveNetwork removes network by its name or ID.
+func RemoveNetwork(ctx context.Context, id string) error {
+	c, err := client.NewClientWithOpts()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if err := c.NetworkRemove(ctx, id); err != nil && !strings.Contains(err.Error(), "not found") {
+		return err
+	}
+
+	return nil
+}
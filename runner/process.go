@@ -0,0 +1,40 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package runner
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ProcessStart returns identifier of process start made of boot ID and process
+// start time, that distinguishes process from later ones reusing its pid.
+func ProcessStart(pid int) (string, error) {
+	data, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return "", err
+	}
+
+	// Process name can contain spaces and parentheses, fields start after last parenthesis.
+	i := bytes.LastIndexByte(data, ')')
+	if i < 0 {
+		return "", errors.New("invalid process stat")
+	}
+
+	// Start time is 22nd field, state being 3rd is the first one after name.
+	fields := strings.Fields(string(data[i+1:]))
+	if len(fields) < 20 {
+		return "", errors.New("invalid process stat")
+	}
+
+	boot, err := os.ReadFile("/proc/sys/kernel/random/boot_id")
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(boot)) + "/" + fields[19], nil
+}
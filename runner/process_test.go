@@ -0,0 +1,33 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package runner
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestProcessStart(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("procfs is not available")
+	}
+
+	start, err := ProcessStart(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if boot, ticks, ok := strings.Cut(start, "/"); !ok || boot == "" || ticks == "" {
+		t.Errorf("start = %s, want boot_id/ticks", start)
+	}
+
+	if again, err := ProcessStart(os.Getpid()); err != nil || again != start {
+		t.Errorf("start = %s (%v), want stable %s", again, err, start)
+	}
+
+	if _, err := ProcessStart(-1); err == nil {
+		t.Error("expected error for missing process")
+	}
+}
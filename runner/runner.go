@@ -9,12 +9,29 @@ import (
 	"time"
 )
 
+// Labels used to mark resources created by vilks.
+const (
+	LabelRunID    = "io.vilks.run"
+	LabelOrigin   = "io.vilks.origin"
+	LabelPID      = "io.vilks.pid"
+	LabelPIDStart = "io.vilks.pid.start"
+	LabelTeam     = "io.vilks.team"
+	LabelHost     = "io.vilks.host"
+	LabelAttack   = "io.vilks.attack"
+	LabelRecipe   = "io.vilks.recipe"
+	LabelStep     = "io.vilks.step"
+	LabelService  = "io.vilks.service"
+)
+
 type Runner interface {
 	CreateWorkspace(ctx context.Context, dir string) error
 	CreateEvidenceStore(ctx context.Context, dir string) error
 	Start(ctx context.Context, cmd StartOptions) error
 	Tail(ctx context.Context) (io.ReadCloser, error)
 	Exec(ctx context.Context, env []string, cmd string, args ...string) (*ExecResult, error)
+	// ExecStream executes command writing its output to writers as it is produced.
+	// Output is not included in the returned result.
+	ExecStream(ctx context.Context, opts ExecOptions) (*ExecResult, error)
 	DownlaodEvidence(ctx context.Context, path string) (io.ReadCloser, error)
 	Stop(ctx context.Context) error
 }
@@ -26,11 +43,82 @@ type StartOptions struct {
 	Shell      string
 	Entrypoint []string
 	Ports      []string
+	Networks   []NetworkAttachment
+	Labels     map[string]string
+	Resources  *Resources
 	Timeout    time.Duration
+
+	User        string
+	CapAdd      []string
+	CapDrop     []string
+	Privileged  bool
+	ReadOnly    bool
+	SecurityOpt []string
+
+	// RestrictEgress is a flag indicating if container can connect only to destinations allowed by Egress rules.
+	// Container entrypoint is started only after firewall rules are in place.
+	RestrictEgress bool
+	Egress         []EgressRule
+}
+
+// EgressRule allows container to connect to destination network.
+type EgressRule struct {
+	// Network is the destination network in CIDR notation.
+	Network string
+	// Ports is the list of allowed destination ports or port ranges, all ports are allowed if empty.
+	Ports []string
+}
+
+// NetworkAttachment describes network container is connected to.
+type NetworkAttachment struct {
+	// Name is the name or ID of the network.
+	Name string
+	// Aliases are the DNS names of the container in the network.
+	Aliases []string
+	// IPAddress is the static IPv4 address of the container in the network.
+	IPAddress string
+}
+
+// Resources limits resources available to a container.
+type Resources struct {
+	// NanoCPUs is the CPU quota in units of 10^-9 CPUs.
+	NanoCPUs int64
+	// Memory is the memory limit in bytes.
+	Memory int64
+	// PidsLimit is the maximum number of processes.
+	PidsLimit int64
+	Ulimits   []Ulimit
+}
+
+type Ulimit struct {
+	Name string
+	Soft int64
+	Hard int64
+}
+
+type ExecOptions struct {
+	Env    []string
+	Cmd    []string
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// TTY is a flag indicating if terminal should be attached, stdout and stderr are combined in this mode.
+	TTY bool
 }
 
 type ExecResult struct {
 	Stdout   []byte
 	Stderr   []byte
 	ExitCode int
+	// OOMKilled is a flag indicating if a process in container was killed because of running out of memory.
+	OOMKilled bool
+}
+
+// Resource is a resource left behind by a vilks run.
+type Resource struct {
+	ID      string
+	Kind    string
+	Name    string
+	Created time.Time
+	Labels  map[string]string
 }
@@ -3,23 +3,81 @@
 
 package scenario
 
+import (
+	"vilks.io/vilks/recipe"
+)
+
 type Scenario struct {
-	Name   string  `json:"name"`
-	Teams  []Team  `json:"teams"`
-	Hosts  []Host  `json:"hosts"`
-	Params []Param `json:"params"`
+	// Include is the list of scenario files merged before this file, paths are relative to this file.
+	Include    []string    `json:"include,omitempty"`
+	Name       string      `json:"name"`
+	Ports      *Ports      `json:"ports,omitempty"`
+	Network    *Network    `json:"network,omitempty"`
+	Scope      *Scope      `json:"scope,omitempty"`
+	Engagement *Engagement `json:"engagement,omitempty"`
+	// Resources is the default resource limits of step and service containers.
+	Resources *recipe.Resources `json:"resources,omitempty"`
+	Teams     []Team            `json:"teams"`
+	Hosts     []Host            `json:"hosts"`
+	Params    []Param           `json:"params"`
+}
+
+// Ports configures host ports assigned to services.
+type Ports struct {
+	// Bind is the default host address to bind service ports on.
+	Bind string `json:"bind"`
+	// Start is the first port of the range.
+	Start int `json:"start"`
+	// End is the last port of the range.
+	End int `json:"end"`
+}
+
+// Network configures existing network attack containers are connected to.
+type Network struct {
+	// Name is the name of existing network.
+	Name string `json:"name"`
+	// Address is the static IP address of step containers in the network.
+	// Team index placeholders can be used.
+	Address string `json:"address,omitempty"`
 }
 
+// Team is the attacking team. In scenario file teams can be also specified
+// as {import: files, generate: generators}, see TeamGenerator for options.
 type Team struct {
 	Name   string  `json:"name"`
 	Index  int     `json:"index"`
 	Params []Param `json:"params"`
+	// Address overrides scenario network static IP address for the team.
+	Address string `json:"address,omitempty"`
 }
 
 type Host struct {
 	Name    string   `json:"name"`
 	Target  string   `json:"host"`
 	Attacks []Attack `json:"attacks"`
+	// Ports are the host ports by name, e.g. http: 80. Team index expressions can be used.
+	Ports map[string]string `json:"ports,omitempty"`
+	// Services are the services running on host, named ports are also considered services.
+	Services []string `json:"services,omitempty"`
+	// OS is the host operating system, e.g. linux or windows.
+	OS string `json:"os,omitempty"`
+	// Params are the free-form host parameters.
+	Params []Param `json:"params,omitempty"`
+	// Nmap resolves target and port from nmap scan output when attack is executed.
+	Nmap *Nmap `json:"nmap,omitempty"`
+}
+
+// Nmap references host in nmap XML scan output.
+type Nmap struct {
+	// File is the path to nmap XML file, relative to scenario file it is declared in.
+	// Team index expressions and parameters can be used.
+	File string `json:"file"`
+	// Match is the host address, network in CIDR notation or host name regular
+	// expression to find host by. Team index expressions and parameters can be used.
+	Match string `json:"match"`
+	// Service is the service name or port number of open port to set target_port
+	// parameter to, if it is not provided in attack parameters.
+	Service string `json:"service,omitempty"`
 }
 
 type Attack struct {
@@ -31,4 +89,25 @@ type Attack struct {
 type Param struct {
 	Name  string `json:"name"`
 	Value string `json:"value"`
+	// Type is the parameter type, values of secret parameters are masked in logs and evidence.
+	// Values of secret parameters and values read from environment or file are not expanded.
+	Type string `json:"type,omitempty"`
+	// FromEnv is the name of environment variable to read value from.
+	FromEnv string `json:"from_env,omitempty"`
+	// FromFile is the path to file to read value from, relative to scenario file it is declared in.
+	// Files can be age or sops encrypted.
+	FromFile string `json:"from_file,omitempty"`
+	// Key is the dot separated key of value in YAML or JSON file.
+	Key string `json:"key,omitempty"`
+}
+
+// Secret returns true if parameter value is secret.
+func (p *Param) Secret() bool {
+	return p.Type == recipe.ParamTypeSecret
+}
+
+// Literal returns true if parameter value must be used as is without
+// substituting team index expressions and parameter references.
+func (p *Param) Literal() bool {
+	return p.Secret() || p.FromEnv != "" || p.FromFile != ""
 }
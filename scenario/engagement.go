@@ -0,0 +1,300 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package scenario
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const defaultKillSwitchInterval = time.Second
+
+// timeLayouts are the supported time formats in engagement rules. Times without
+// time zone are in local time.
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02 15:04:05",
+}
+
+// ErrKillSwitch is returned when attack is aborted by kill switch.
+type ErrKillSwitch struct {
+	Reason string
+}
+
+func (e *ErrKillSwitch) Error() string {
+	return "kill switch triggered: " + e.Reason
+}
+
+// Engagement is the rules of engagement of the scenario.
+type Engagement struct {
+	// Windows is the list of time windows attacks are allowed in, any applicable window must contain attack time.
+	Windows []Window `json:"windows,omitempty"`
+	// Blackouts is the list of time periods attacks are not allowed in.
+	Blackouts []Window `json:"blackouts,omitempty"`
+	// KillSwitches is the list of kill switches that abort running attacks.
+	KillSwitches []KillSwitch `json:"kill_switches,omitempty"`
+}
+
+// Window is a time period that applies to given teams and hosts. Empty teams or
+// hosts list means that window applies to all teams or hosts.
+type Window struct {
+	Teams []string `json:"teams,omitempty"`
+	Hosts []string `json:"hosts,omitempty"`
+	// Start is the start time of the window, unbounded if empty.
+	Start string `json:"start,omitempty"`
+	// End is the end time of the window, unbounded if empty.
+	End string `json:"end,omitempty"`
+	// Reason is the reason of the blackout.
+	Reason string `json:"reason,omitempty"`
+}
+
+func (w *Window) applies(team, host string) bool {
+	return (len(w.Teams) == 0 || slices.Contains(w.Teams, team)) &&
+		(len(w.Hosts) == 0 || slices.Contains(w.Hosts, host))
+}
+
+func (w *Window) contains(t time.Time) (bool, error) {
+	if w.Start != "" {
+		start, err := parseTime(w.Start)
+		if err != nil {
+			return false, err
+		}
+
+		if t.Before(start) {
+			return false, nil
+		}
+	}
+
+	if w.End != "" {
+		end, err := parseTime(w.End)
+		if err != nil {
+			return false, err
+		}
+
+		if !t.Before(end) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func (w *Window) validate() error {
+	var (
+		start, end time.Time
+		err        error
+	)
+
+	if w.Start != "" {
+		if start, err = parseTime(w.Start); err != nil {
+			return err
+		}
+	}
+
+	if w.End != "" {
+		if end, err = parseTime(w.End); err != nil {
+			return err
+		}
+	}
+
+	if !start.IsZero() && !end.IsZero() && !end.After(start) {
+		return fmt.Errorf("time window %s ends before it starts", w.String())
+	}
+
+	return nil
+}
+
+func (w *Window) String() string {
+	switch {
+	case w.Start == "":
+		return "until " + w.End
+	case w.End == "":
+		return "from " + w.Start
+	default:
+		return w.Start + " - " + w.End
+	}
+}
+
+// KillSwitch aborts running attacks when file exists or URL does not respond
+// with 200 OK status. Empty hosts list means that kill switch applies to all hosts.
+type KillSwitch struct {
+	Hosts []string `json:"hosts,omitempty"`
+	// File is the path to the file that triggers kill switch when it exists.
+	File string `json:"file,omitempty"`
+	// URL is the HTTP endpoint that triggers kill switch when it is not reachable
+	// or does not respond with 200 OK status.
+	URL string `json:"url,omitempty"`
+	// Interval is the time between kill switch checks.
+	Interval time.Duration `json:"interval,omitempty"`
+}
+
+func (k *KillSwitch) check(ctx context.Context) error {
+	if k.File != "" {
+		if _, err := os.Stat(k.File); err == nil {
+			return &ErrKillSwitch{Reason: fmt.Sprintf("file '%s' exists", k.File)}
+		}
+	}
+
+	if k.URL != "" {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.URL, nil)
+		if err != nil {
+			return &ErrKillSwitch{Reason: err.Error()}
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			if errors.Is(ctx.Err(), context.Canceled) {
+				return nil
+			}
+
+			return &ErrKillSwitch{Reason: fmt.Sprintf("endpoint '%s' is not reachable: %s", k.URL, err.Error())}
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return &ErrKillSwitch{Reason: fmt.Sprintf("endpoint '%s' responded with status %d", k.URL, resp.StatusCode)}
+		}
+	}
+
+	return nil
+}
+
+func (e *Engagement) validate() error {
+	for _, w := range slices.Concat(e.Windows, e.Blackouts) {
+		if err := w.validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, k := range e.KillSwitches {
+		if k.File == "" && k.URL == "" {
+			return errors.New("kill switch must have file or URL")
+		}
+	}
+
+	return nil
+}
+
+// Allowed checks if attacks on host by team are allowed at given time. If any
+// time windows apply to team and host, time must be in at least one of them.
+func (e *Engagement) Allowed(team, host string, t time.Time) error {
+	var windows []string
+
+	for _, w := range e.Windows {
+		if !w.applies(team, host) {
+			continue
+		}
+
+		ok, err := w.contains(t)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			windows = nil
+
+			break
+		}
+
+		windows = append(windows, w.String())
+	}
+
+	if len(windows) > 0 {
+		return fmt.Errorf("outside of allowed time windows %s", strings.Join(windows, ", "))
+	}
+
+	for _, w := range e.Blackouts {
+		if !w.applies(team, host) {
+			continue
+		}
+
+		ok, err := w.contains(t)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			if w.Reason != "" {
+				return fmt.Errorf("in blackout period %s: %s", w.String(), w.Reason)
+			}
+
+			return fmt.Errorf("in blackout period %s", w.String())
+		}
+	}
+
+	return nil
+}
+
+// killSwitches returns kill switches that apply to host.
+func (e *Engagement) killSwitches(host string) []KillSwitch {
+	res := make([]KillSwitch, 0, len(e.KillSwitches))
+
+	for _, k := range e.KillSwitches {
+		if len(k.Hosts) == 0 || slices.Contains(k.Hosts, host) {
+			res = append(res, k)
+		}
+	}
+
+	return res
+}
+
+// CheckKillSwitches returns error if any kill switch for host is triggered.
+func (e *Engagement) CheckKillSwitches(ctx context.Context, host string) error {
+	for _, k := range e.killSwitches(host) {
+		if err := k.check(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// watch cancels context when any of kill switches for host is triggered.
+func (e *Engagement) watch(ctx context.Context, host string, cancel func(err error)) {
+	for _, k := range e.killSwitches(host) {
+		interval := k.Interval
+		if interval <= 0 {
+			interval = defaultKillSwitchInterval
+		}
+
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if err := k.check(ctx); err != nil {
+						cancel(err)
+
+						return
+					}
+				}
+			}
+		}()
+	}
+}
+
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time '%s'", s)
+}
@@ -0,0 +1,139 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package scenario
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEngagementAllowed(t *testing.T) {
+	at := func(s string) time.Time {
+		t.Helper()
+
+		tm, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return tm
+	}
+
+	e := &Engagement{
+		Windows: []Window{
+			{Start: "2024-05-01 09:00", End: "2024-05-01 12:00"},
+			{Start: "2024-05-01T11:00", End: "2024-05-01T17:00"},
+			{Teams: []string{"Team 2"}, Start: "2024-05-02 09:00:00"},
+			{Hosts: []string{"db"}, End: "2024-05-01 10:00"},
+		},
+		Blackouts: []Window{
+			{Start: "2024-05-01 12:00", End: "2024-05-01 13:00", Reason: "lunch"},
+			{Hosts: []string{"web"}, Start: "2024-05-01 15:00", End: "2024-05-01 16:00"},
+		},
+	}
+
+	tests := []struct {
+		name string
+		team string
+		host string
+		at   string
+		err  string
+	}{
+		{name: "first window", team: "Team 1", host: "web", at: "2024-05-01 09:00"},
+		{name: "overlapping windows", team: "Team 1", host: "web", at: "2024-05-01 11:30"},
+		{name: "second window", team: "Team 1", host: "web", at: "2024-05-01 16:59"},
+		{name: "before start", team: "Team 1", host: "web", at: "2024-05-01 08:59", err: "outside of allowed time windows 2024-05-01 09:00 - 2024-05-01 12:00, 2024-05-01T11:00 - 2024-05-01T17:00"},
+		{name: "end exclusive", team: "Team 1", host: "web", at: "2024-05-01 17:00", err: "outside of allowed time windows"},
+		{name: "blackout precedence", team: "Team 1", host: "web", at: "2024-05-01 12:30", err: "in blackout period 2024-05-01 12:00 - 2024-05-01 13:00: lunch"},
+		{name: "host blackout", team: "Team 1", host: "web", at: "2024-05-01 15:30", err: "in blackout period 2024-05-01 15:00 - 2024-05-01 16:00"},
+		{name: "host blackout other host", team: "Team 1", host: "mail", at: "2024-05-01 15:30"},
+		{name: "team window", team: "Team 2", host: "web", at: "2024-05-03 10:00"},
+		{name: "team window other team", team: "Team 1", host: "web", at: "2024-05-03 10:00", err: "outside of allowed time windows"},
+		{name: "host window", team: "Team 1", host: "db", at: "2024-04-30 10:00"},
+		{name: "host window other host", team: "Team 1", host: "web", at: "2024-04-30 10:00", err: "outside of allowed time windows"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := e.Allowed(tt.team, tt.host, at(tt.at))
+
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+
+	if err := (&Engagement{}).Allowed("Team 1", "web", time.Now()); err != nil {
+		t.Errorf("no rules: %v", err)
+	}
+}
+
+func TestWindowContains(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("EET", 2*60*60)
+
+	t.Cleanup(func() { time.Local = local })
+
+	utc := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		window Window
+		want   bool
+	}{
+		{window: Window{}, want: true},
+		{window: Window{Start: "2024-05-01T10:00:00Z"}, want: true},
+		{window: Window{End: "2024-05-01T10:00:00Z"}},
+		{window: Window{Start: "2024-05-01T12:00:00+02:00", End: "2024-05-01T13:00:00+02:00"}, want: true},
+		{window: Window{Start: "2024-05-01T10:00:01Z"}},
+		{window: Window{Start: "2024-05-01 12:00"}, want: true},
+		{window: Window{Start: "2024-05-01T12:01"}},
+		{window: Window{End: "2024-05-01 12:00:00"}},
+		{window: Window{End: "2024-05-01 12:00:01"}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.window.String(), func(t *testing.T) {
+			got, err := tt.window.contains(utc)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("contains = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEngagementValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		e    Engagement
+		err  string
+	}{
+		{name: "valid", e: Engagement{Windows: []Window{{Start: "2024-05-01 09:00", End: "2024-05-01 17:00"}}}},
+		{name: "open ended", e: Engagement{Blackouts: []Window{{Start: "2024-05-01 09:00"}, {End: "2024-05-01 09:00"}}}},
+		{name: "invalid time", e: Engagement{Windows: []Window{{Start: "tomorrow"}}}, err: "invalid time 'tomorrow'"},
+		{name: "end before start", e: Engagement{Windows: []Window{{Start: "2024-05-01 17:00", End: "2024-05-01 09:00"}}}, err: "ends before it starts"},
+		{name: "empty window", e: Engagement{Blackouts: []Window{{Start: "2024-05-01 09:00", End: "2024-05-01T09:00"}}}, err: "ends before it starts"},
+		{name: "kill switch", e: Engagement{KillSwitches: []KillSwitch{{}}}, err: "kill switch must have file or URL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.e.validate()
+
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package scenario
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"vilks.io/vilks/recipe"
+)
+
+// host returns expanded host parameters: name, os, comma separated list of
+// services, port_<name> for each named port and free-form host parameters.
+func (v *vars) host(host *Host) (map[string]string, error) {
+	params := make(map[string]string, len(host.Ports)+len(host.Params)+3)
+
+	params["name"] = host.Name
+
+	os, err := v.expand(host.OS)
+	if err != nil {
+		return nil, fmt.Errorf("host '%s' os: %w", host.Name, err)
+	}
+
+	params["os"] = os
+	params["services"] = strings.Join(host.services(), ",")
+
+	for name, val := range host.Ports {
+		port, err := v.expand(val)
+		if err != nil {
+			return nil, fmt.Errorf("host '%s' port '%s': %w", host.Name, name, err)
+		}
+
+		if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+			return nil, fmt.Errorf("host '%s' port '%s' has invalid value '%s'", host.Name, name, port)
+		}
+
+		params["port_"+name] = port
+	}
+
+	for _, prm := range host.Params {
+		if params[prm.Name], err = v.value(&prm); err != nil {
+			return nil, fmt.Errorf("host '%s' parameter '%s': %w", host.Name, prm.Name, err)
+		}
+	}
+
+	return params, nil
+}
+
+// services returns sorted list of host services including named ports.
+func (h *Host) services() []string {
+	services := slices.Clone(h.Services)
+
+	for name := range h.Ports {
+		if !slices.Contains(services, name) {
+			services = append(services, name)
+		}
+	}
+
+	slices.Sort(services)
+
+	return slices.Compact(services)
+}
+
+// checkRequires checks if host provides capabilities required by recipe.
+// Services and ports of hosts resolved from nmap scan are known only at
+// execution time so they are not checked.
+func (h *Host) checkRequires(req *recipe.Requirements) error {
+	if req == nil {
+		return nil
+	}
+
+	if req.OS != "" && !strings.EqualFold(req.OS, h.OS) {
+		return fmt.Errorf("requires host os '%s'", req.OS)
+	}
+
+	if h.Nmap != nil {
+		return nil
+	}
+
+	services := h.services()
+
+	for _, svc := range req.Services {
+		if !slices.Contains(services, svc) {
+			return fmt.Errorf("requires host service '%s'", svc)
+		}
+	}
+
+	for _, port := range req.Ports {
+		if _, ok := h.Ports[port]; !ok {
+			return fmt.Errorf("requires host port '%s'", port)
+		}
+	}
+
+	return nil
+}
@@ -5,7 +5,9 @@ package scenario
 
 import (
 	"context"
-	"os"
+	"errors"
+	"fmt"
+	"path/filepath"
 
 	"github.com/goccy/go-yaml"
 )
@@ -21,10 +23,54 @@ func Load(ctx context.Context, data []byte) (*Scenario, error) {
 }
 
 func LoadFile(ctx context.Context, path string) (*Scenario, error) {
-	data, err := os.ReadFile(path)
+	return LoadFiles(ctx, []string{path}, nil)
+}
+
+// LoadFiles loads scenario from files with their includes, each file
+// is merged over previous ones. Overrides in form key=value are applied last,
+// before teams are imported and generated.
+// Relative file paths of all files are rewritten to be relative to the first file.
+func LoadFiles(ctx context.Context, paths, overrides []string) (*Scenario, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("no scenario files")
+	}
+
+	var tree any = map[string]any{}
+
+	for _, path := range paths {
+		t, err := loadTree(path, filepath.Dir(paths[0]), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		tree = merge(tree, t)
+	}
+
+	m, _ := tree.(map[string]any)
+
+	for _, o := range overrides {
+		if err := set(m, o); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := expandTeams(m, filepath.Dir(paths[0])); err != nil {
+		return nil, fmt.Errorf("invalid teams: %w", err)
+	}
+
+	data, err := yaml.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := Load(ctx, data)
 	if err != nil {
 		return nil, err
 	}
 
-	return Load(ctx, data)
+	if err := s.validateTeams(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
 }
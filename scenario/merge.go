@@ -0,0 +1,361 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package scenario
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// merge merges overlay into base. Maps are merged recursively, lists of
+// named items (teams, hosts, attacks, params) are merged by item name
+// keeping order of base items and appending new ones, any other values
+// are replaced by overlay.
+func merge(base, overlay any) any {
+	switch o := overlay.(type) {
+	case map[string]any:
+		b, ok := base.(map[string]any)
+		if !ok {
+			return o
+		}
+
+		res := make(map[string]any, len(b)+len(o))
+		for k, v := range b {
+			res[k] = v
+		}
+
+		for k, v := range o {
+			res[k] = merge(b[k], v)
+		}
+
+		return res
+	case []any:
+		b, ok := base.([]any)
+		if !ok || !namedItems(b) || !namedItems(o) {
+			return o
+		}
+
+		res := make([]any, len(b), len(b)+len(o))
+		copy(res, b)
+
+		for _, item := range o {
+			i := findNamed(res, itemName(item))
+			if i < 0 {
+				res = append(res, item)
+
+				continue
+			}
+
+			res[i] = merge(res[i], item)
+		}
+
+		return res
+	case nil:
+		return base
+	default:
+		return o
+	}
+}
+
+func itemName(item any) string {
+	m, _ := item.(map[string]any)
+	name, _ := m["name"].(string)
+
+	return name
+}
+
+// namedItems returns true if all list items are maps with name.
+func namedItems(items []any) bool {
+	for _, item := range items {
+		if itemName(item) == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isMap(v any) bool {
+	_, ok := v.(map[string]any)
+
+	return ok
+}
+
+func findNamed(items []any, name string) int {
+	for i, item := range items {
+		if itemName(item) == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// loadTree loads scenario file with included files merged before it.
+// Included file paths are relative to the including file.
+func loadTree(path, baseDir string, seen []string) (map[string]any, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range seen {
+		if p == abs {
+			return nil, fmt.Errorf("scenario file '%s' includes itself", path)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tree map[string]any
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return nil, fmt.Errorf("failed to parse '%s': %w", path, err)
+	}
+
+	if err := splitTeams(tree); err != nil {
+		return nil, fmt.Errorf("invalid teams in '%s': %w", path, err)
+	}
+
+	if err := rebasePaths(tree, filepath.Dir(abs), baseDir); err != nil {
+		return nil, err
+	}
+
+	var includes []string
+
+	switch inc := tree["include"].(type) {
+	case nil:
+	case string:
+		includes = []string{inc}
+	case []any:
+		for _, v := range inc {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid include in '%s'", path)
+			}
+
+			includes = append(includes, s)
+		}
+	default:
+		return nil, fmt.Errorf("invalid include in '%s'", path)
+	}
+
+	delete(tree, "include")
+
+	var res any = map[string]any{}
+
+	for _, inc := range includes {
+		if !filepath.IsAbs(inc) {
+			inc = filepath.Join(filepath.Dir(path), inc)
+		}
+
+		sub, err := loadTree(inc, baseDir, append(seen, abs))
+		if err != nil {
+			return nil, err
+		}
+
+		res = merge(res, sub)
+	}
+
+	res = merge(res, tree)
+
+	m, _ := res.(map[string]any)
+
+	return m, nil
+}
+
+// rebasePaths rewrites relative file paths in scenario fragment loaded from
+// dir to be relative to baseDir, the directory of the main scenario file, so
+// that paths are resolved relative to the file they are declared in. Paths
+// starting with parameter reference are kept as is.
+func rebasePaths(tree map[string]any, dir, baseDir string) error {
+	base, err := filepath.Abs(baseDir)
+	if err != nil {
+		return err
+	}
+
+	rebasePath := func(v any) any {
+		p, ok := v.(string)
+		if !ok || p == "" || filepath.IsAbs(p) || strings.HasPrefix(p, "$") {
+			return v
+		}
+
+		p = filepath.Join(dir, p)
+		if rel, err := filepath.Rel(base, p); err == nil {
+			p = rel
+		}
+
+		return p
+	}
+
+	rebase := func(m map[string]any, key string) {
+		if v, ok := m[key]; ok {
+			m[key] = rebasePath(v)
+		}
+	}
+
+	params := func(v any) {
+		for _, item := range listOf(v) {
+			if m, ok := item.(map[string]any); ok {
+				rebase(m, "from_file")
+			}
+		}
+	}
+
+	params(tree["params"])
+
+	if spec, ok := tree[teamsSpec].(map[string]any); ok {
+		if imports := listOf(spec["import"]); len(imports) > 0 {
+			for i, path := range imports {
+				imports[i] = rebasePath(path)
+			}
+
+			spec["import"] = imports
+		}
+	}
+
+	for _, item := range listOf(tree["teams"]) {
+		if team, ok := item.(map[string]any); ok {
+			params(team["params"])
+		}
+	}
+
+	for _, item := range listOf(tree["hosts"]) {
+		host, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		params(host["params"])
+
+		for _, item := range listOf(host["attacks"]) {
+			if attack, ok := item.(map[string]any); ok {
+				params(attack["params"])
+			}
+		}
+
+		if nmap, ok := host["nmap"].(map[string]any); ok {
+			rebase(nmap, "file")
+		}
+	}
+
+	return nil
+}
+
+// set sets value at dot separated key path. Lists are indexed by item
+// name or position, missing named items are appended. Value is parsed as YAML.
+// Scalar value set on parameter, e.g. params.name=value, sets parameter value.
+// Teams import and generators are set with teams.import and teams.generate keys.
+func set(tree map[string]any, override string) error {
+	key, value, ok := strings.Cut(override, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("invalid override '%s', expected key=value", override)
+	}
+
+	var v any
+	if err := yaml.Unmarshal([]byte(value), &v); err != nil {
+		v = value
+	}
+
+	path := strings.Split(key, ".")
+	if len(path) > 1 && path[0] == "teams" && (path[1] == "import" || path[1] == "generate") {
+		path[0] = teamsSpec
+	}
+
+	if _, err := setPath(tree, path, v); err != nil {
+		return fmt.Errorf("invalid override '%s': %w", override, err)
+	}
+
+	return nil
+}
+
+// namedLists are the keys of scenario lists with named items.
+var namedLists = map[string]bool{
+	"teams":   true,
+	"hosts":   true,
+	"attacks": true,
+	"params":  true,
+}
+
+func setPath(node any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	key, rest := path[0], path[1:]
+
+	switch n := node.(type) {
+	case nil:
+		v, err := setPath(nil, rest, value)
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string]any{key: v}, nil
+	case map[string]any:
+		child := n[key]
+		if child == nil && namedLists[key] {
+			child = []any{}
+		}
+
+		if _, ok := value.([]any); namedLists[key] && len(rest) == 0 && !ok {
+			return nil, fmt.Errorf("'%s' can only be set to a list", key)
+		}
+
+		// Scalar set on named parameter sets its value, parameters of
+		// team generators are a mapping and are set as is.
+		if _, ok := value.(map[string]any); key == "params" && len(rest) == 1 && !ok && !isMap(child) {
+			rest = []string{rest[0], "value"}
+		}
+
+		v, err := setPath(child, rest, value)
+		if err != nil {
+			return nil, err
+		}
+
+		n[key] = v
+
+		return n, nil
+	case []any:
+		i := findNamed(n, key)
+		if i < 0 {
+			if idx, err := strconv.Atoi(key); err == nil && idx >= 0 && idx < len(n) {
+				i = idx
+			} else {
+				n = append(n, map[string]any{"name": key})
+				i = len(n) - 1
+			}
+		}
+
+		if len(rest) == 0 {
+			m, ok := value.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("list item '%s' can only be set to a mapping", key)
+			}
+
+			if _, ok := m["name"]; !ok && itemName(n[i]) == key {
+				m["name"] = key
+			}
+		}
+
+		v, err := setPath(n[i], rest, value)
+		if err != nil {
+			return nil, err
+		}
+
+		n[i] = v
+
+		return n, nil
+	default:
+		return nil, errors.New("key '" + key + "' can not be set on value")
+	}
+}
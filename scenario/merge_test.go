@@ -0,0 +1,408 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package scenario
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+)
+
+// parseTree parses YAML fixture into scenario tree.
+func parseTree(t *testing.T, data string) map[string]any {
+	t.Helper()
+
+	var tree map[string]any
+	if err := yaml.Unmarshal([]byte(data), &tree); err != nil {
+		t.Fatal(err)
+	}
+
+	return tree
+}
+
+// assertTree checks that tree is equal to YAML fixture.
+func assertTree(t *testing.T, tree any, want string) {
+	t.Helper()
+
+	got, err := yaml.Marshal(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := yaml.Marshal(parseTree(t, want))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(got) != string(w) {
+		t.Errorf("got:\n%s\nwant:\n%s", got, w)
+	}
+}
+
+// mustYAML marshals value to YAML.
+func mustYAML(t *testing.T, v any) string {
+	t.Helper()
+
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data)
+}
+
+// writeFiles writes YAML fixtures to temporary directory and returns its path.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    string
+		overlay string
+		want    string
+	}{
+		{
+			name: "named lists",
+			base: `
+teams:
+- name: Team 1
+  index: 1
+  params:
+  - name: web
+    value: 10.0.1.5
+- name: Team 2
+  index: 2
+`,
+			overlay: `
+teams:
+- name: Team 2
+  index: 5
+- name: Team 1
+  params:
+  - name: web
+    value: 10.0.1.6
+  - name: db
+    value: 10.0.1.7
+- name: Team 3
+  index: 3
+`,
+			want: `
+teams:
+- name: Team 1
+  index: 1
+  params:
+  - name: web
+    value: 10.0.1.6
+  - name: db
+    value: 10.0.1.7
+- name: Team 2
+  index: 5
+- name: Team 3
+  index: 3
+`,
+		},
+		{
+			name: "scalars and maps",
+			base: `
+network:
+  name: lab
+  address: 10.0.0.{x}
+ports:
+  start: 5000
+`,
+			overlay: `
+network:
+  address: 10.1.0.{x}
+ports: ~
+`,
+			want: `
+network:
+  name: lab
+  address: 10.1.0.{x}
+ports:
+  start: 5000
+`,
+		},
+		{
+			name: "unnamed lists replaced",
+			base: `
+scope:
+  allow:
+  - cidrs: [10.0.0.0/8]
+hosts:
+- name: web
+`,
+			overlay: `
+scope:
+  allow:
+  - cidrs: [192.168.0.0/16]
+hosts:
+- host: 10.0.0.1
+`,
+			want: `
+scope:
+  allow:
+  - cidrs: [192.168.0.0/16]
+hosts:
+- host: 10.0.0.1
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertTree(t, merge(parseTree(t, tt.base), parseTree(t, tt.overlay)), tt.want)
+		})
+	}
+}
+
+func TestSet(t *testing.T) {
+	base := `
+params:
+- name: domain
+  value: lab
+teams:
+- name: Team 1
+  index: 1
+  params:
+  - name: web
+    value: 10.0.1.5
+hosts:
+- name: web
+  host: ${web}
+`
+
+	tests := []struct {
+		name     string
+		override string
+		want     string
+		err      string
+	}{
+		{
+			name:     "named item",
+			override: "teams.Team 1.index=3",
+			want:     "teams:\n- name: Team 1\n  index: 3\n  params:\n  - name: web\n    value: 10.0.1.5\n",
+		},
+		{
+			name:     "indexed item",
+			override: "teams.0.params.0.value=10.0.1.6",
+			want:     "teams:\n- name: Team 1\n  index: 1\n  params:\n  - name: web\n    value: 10.0.1.6\n",
+		},
+		{
+			name:     "parameter value",
+			override: "params.domain=test.lab",
+			want:     "params:\n- name: domain\n  value: test.lab\n",
+		},
+		{
+			name:     "new parameter",
+			override: "params.port=8080",
+			want:     "params:\n- name: domain\n  value: lab\n- name: port\n  value: 8080\n",
+		},
+		{
+			name:     "parameter mapping",
+			override: "params.domain={from_env: DOMAIN}",
+			want:     "params:\n- name: domain\n  from_env: DOMAIN\n",
+		},
+		{
+			name:     "new map",
+			override: "network.address=10.0.{x}.1",
+			want:     "network:\n  address: 10.0.{x}.1\n",
+		},
+		{
+			name:     "list",
+			override: "hosts=[{name: db, host: 10.0.0.2}]",
+			want:     "hosts:\n- name: db\n  host: 10.0.0.2\n",
+		},
+		{name: "invalid", override: "teams", err: "expected key=value"},
+		{name: "named list scalar", override: "teams=Team 1", err: "'teams' can only be set to a list"},
+		{name: "list item scalar", override: "hosts.web=db", err: "list item 'web' can only be set to a mapping"},
+		{name: "scalar key", override: "hosts.web.host.ip=10.0.0.1", err: "key 'ip' can not be set on value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := parseTree(t, base)
+
+			err := set(tree, tt.override)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := parseTree(t, base)
+			for k, v := range parseTree(t, tt.want) {
+				want[k] = v
+			}
+
+			assertTree(t, tree, mustYAML(t, want))
+		})
+	}
+}
+
+func TestLoadTree(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"scenario.yaml": `
+include: [common/hosts.yaml, secrets.yaml]
+params:
+- name: domain
+  value: override.lab
+`,
+		"common/hosts.yaml": `
+include: params.yaml
+hosts:
+- name: web
+  host: web.${domain}
+  nmap:
+    file: nmap/team{x}.xml
+  params:
+  - name: key
+    from_file: keys/web.key
+  attacks:
+  - name: scan
+    recipe: nmap
+    params:
+    - name: wordlist
+      from_file: ../lists/words.txt
+    - name: token
+      from_file: ${token_file}
+    - name: abs
+      from_file: /etc/hostname
+`,
+		"common/params.yaml": `
+params:
+- name: domain
+  value: common.lab
+- name: port
+  value: "80"
+`,
+		"secrets.yaml": `
+teams:
+- name: Team 1
+  index: 1
+  params:
+  - name: password
+    from_file: secrets/team1.age
+`,
+		"loop/a.yaml": "include: b.yaml\n",
+		"loop/b.yaml": "include: [../loop/a.yaml]\n",
+		"self.yaml":   "include: self.yaml\n",
+	})
+
+	tree, err := loadTree(filepath.Join(dir, "scenario.yaml"), dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertTree(t, tree, `
+params:
+- name: domain
+  value: override.lab
+- name: port
+  value: "80"
+hosts:
+- name: web
+  host: web.${domain}
+  nmap:
+    file: common/nmap/team{x}.xml
+  params:
+  - name: key
+    from_file: common/keys/web.key
+  attacks:
+  - name: scan
+    recipe: nmap
+    params:
+    - name: wordlist
+      from_file: lists/words.txt
+    - name: token
+      from_file: ${token_file}
+    - name: abs
+      from_file: /etc/hostname
+teams:
+- name: Team 1
+  index: 1
+  params:
+  - name: password
+    from_file: secrets/team1.age
+`)
+
+	for _, name := range []string{"loop/a.yaml", "self.yaml"} {
+		_, err := loadTree(filepath.Join(dir, name), dir, nil)
+		if err == nil || !strings.Contains(err.Error(), "includes itself") {
+			t.Errorf("%s: error = %v, want include cycle error", name, err)
+		}
+	}
+
+	if _, err := loadTree(filepath.Join(dir, "missing.yaml"), dir, nil); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestLoadFiles(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"scenario.yaml": `
+params:
+- name: domain
+  value: lab
+teams:
+- name: Team 1
+  index: 1
+hosts:
+- name: web
+  host: web.${domain}
+`,
+		"env/lab.yaml": `
+params:
+- name: key
+  from_file: lab.key
+teams:
+- name: Team 1
+  index: 7
+`,
+	})
+
+	s, err := LoadFiles(context.Background(), []string{filepath.Join(dir, "scenario.yaml"), filepath.Join(dir, "env/lab.yaml")}, []string{
+		"params.domain=test.lab",
+		"hosts.web.host=10.0.0.5",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Teams[0].Index != 7 || s.Hosts[0].Target != "10.0.0.5" {
+		t.Errorf("team index = %d, host = %s", s.Teams[0].Index, s.Hosts[0].Target)
+	}
+
+	if s.Params[0].Value != "test.lab" || s.Params[1].FromFile != filepath.Join("env", "lab.key") {
+		t.Errorf("params = %+v", s.Params)
+	}
+}
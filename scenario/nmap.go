@@ -0,0 +1,234 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package scenario
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"vilks.io/vilks/nmap"
+
+	"github.com/goccy/go-yaml"
+)
+
+// resolveNmap returns host address from nmap scan output and sets target_port
+// parameter if it is not already set.
+func (s *Scene) resolveNmap(v *vars, host *Host, params map[string]string) (string, error) {
+	file, match, err := v.nmap(host)
+	if err != nil {
+		return "", err
+	}
+
+	// Relative paths of included and overlay files are rebased to the main scenario file.
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(s.dir, file)
+	}
+
+	run, err := nmap.ParseFile(file)
+	if err != nil {
+		return "", fmt.Errorf("host '%s' nmap file: %w", host.Name, err)
+	}
+
+	h, err := run.Find(match)
+	if err != nil {
+		return "", fmt.Errorf("host '%s' nmap match: %w", host.Name, err)
+	}
+
+	if h == nil {
+		return "", fmt.Errorf("host '%s' matching '%s' not found in '%s'", host.Name, match, file)
+	}
+
+	if _, ok := params["target_port"]; !ok && host.Nmap.Service != "" {
+		p := h.Port(host.Nmap.Service)
+		if p == nil {
+			return "", fmt.Errorf("host '%s' has no open port for service '%s' in '%s'", host.Name, host.Nmap.Service, file)
+		}
+
+		params["target_port"] = strconv.Itoa(p.PortID)
+	}
+
+	return h.Address(), nil
+}
+
+// nmap returns expanded nmap file path and host match.
+func (v *vars) nmap(host *Host) (string, string, error) {
+	file, err := v.expand(host.Nmap.File)
+	if err != nil {
+		return "", "", fmt.Errorf("host '%s' nmap file: %w", host.Name, err)
+	}
+
+	match, err := v.expand(host.Nmap.Match)
+	if err != nil {
+		return "", "", fmt.Errorf("host '%s' nmap match: %w", host.Name, err)
+	}
+
+	return file, match, nil
+}
+
+// TeamScan is the nmap scan output of the team infrastructure.
+type TeamScan struct {
+	// Team is the team name, empty if scan is not team specific.
+	Team string
+	Run  *nmap.Run
+}
+
+// importedHost is the host discovered in nmap scans.
+type importedHost struct {
+	key      string
+	target   string
+	ports    yaml.MapSlice
+	services []string
+}
+
+// addPort adds named port of the host referencing the port parameter, and
+// service name if it differs from the port name, e.g. http service of https port.
+func (h *importedHost) addPort(name, service, param string) {
+	if !slices.ContainsFunc(h.ports, func(item yaml.MapItem) bool { return item.Key == name }) {
+		h.ports = append(h.ports, yaml.MapItem{Key: name, Value: "${" + param + "}"})
+	}
+
+	if service != "" && service != name && !slices.Contains(h.services, service) {
+		h.services = append(h.services, service)
+	}
+}
+
+func (h *importedHost) item() yaml.MapSlice {
+	item := yaml.MapSlice{
+		{Key: "name", Value: h.key},
+		{Key: "host", Value: h.target},
+	}
+
+	if len(h.services) > 0 {
+		item = append(item, yaml.MapItem{Key: "services", Value: h.services})
+	}
+
+	if len(h.ports) > 0 {
+		item = append(item, yaml.MapItem{Key: "ports", Value: h.ports})
+	}
+
+	return append(item, yaml.MapItem{Key: "attacks", Value: []any{}})
+}
+
+// ImportNmap proposes scenario fragment with hosts discovered in nmap scans.
+// Hosts of scans without team have scanned addresses as targets and open
+// ports as global parameters. For team scans addresses and ports are team
+// parameters that hosts reference, hosts are matched between teams by host
+// name or by last address octet. Host ports reference port parameters, so
+// that recipe requirements are matched against imported hosts.
+func ImportNmap(scans []TeamScan) yaml.MapSlice {
+	var (
+		hosts  []*importedHost
+		teams  []any
+		params []any
+	)
+
+	for _, scan := range scans {
+		var (
+			prms  []any
+			names []string
+		)
+
+		for _, h := range scan.Run.Up() {
+			key := hostKey(h)
+
+			i := slices.IndexFunc(hosts, func(host *importedHost) bool { return host.key == key })
+			if i < 0 {
+				target := h.Address()
+				if scan.Team != "" {
+					target = "${" + key + "_host}"
+				}
+
+				hosts = append(hosts, &importedHost{key: key, target: target})
+				i = len(hosts) - 1
+			}
+
+			if scan.Team != "" {
+				prms = append(prms, param(key+"_host", h.Address()))
+			}
+
+			for _, p := range h.OpenPorts() {
+				port := sanitize(p.Name())
+				name := key + "_" + port + "_port"
+
+				if slices.Contains(names, name) {
+					continue
+				}
+
+				names = append(names, name)
+				prms = append(prms, param(name, strconv.Itoa(p.PortID)))
+
+				hosts[i].addPort(port, p.Service.Name, name)
+			}
+		}
+
+		if scan.Team == "" {
+			params = append(params, prms...)
+
+			continue
+		}
+
+		teams = append(teams, yaml.MapSlice{
+			{Key: "name", Value: scan.Team},
+			{Key: "params", Value: prms},
+		})
+	}
+
+	items := make([]any, 0, len(hosts))
+	for _, h := range hosts {
+		items = append(items, h.item())
+	}
+
+	res := yaml.MapSlice{}
+
+	if len(teams) > 0 {
+		res = append(res, yaml.MapItem{Key: "teams", Value: teams})
+	}
+
+	res = append(res, yaml.MapItem{Key: "hosts", Value: items})
+
+	if len(params) > 0 {
+		res = append(res, yaml.MapItem{Key: "params", Value: params})
+	}
+
+	return res
+}
+
+func param(name, value string) yaml.MapSlice {
+	return yaml.MapSlice{
+		{Key: "name", Value: name},
+		{Key: "value", Value: value},
+	}
+}
+
+// hostKey returns name of host used to match hosts between scans.
+func hostKey(h *nmap.Host) string {
+	if name := h.Hostname(); name != "" {
+		return sanitize(strings.SplitN(name, ".", 2)[0])
+	}
+
+	addr := h.Address()
+	if ip := net.ParseIP(addr).To4(); ip != nil {
+		return "host_" + strconv.Itoa(int(ip[3]))
+	}
+
+	return "host_" + sanitize(addr)
+}
+
+// sanitize returns s usable as parameter name.
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		default:
+			return '_'
+		}
+	}, s)
+}
@@ -0,0 +1,255 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package scenario
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"vilks.io/vilks/nmap"
+	"vilks.io/vilks/recipe"
+
+	"github.com/goccy/go-yaml"
+)
+
+func parseScans(t *testing.T, files map[string]string) []TeamScan {
+	t.Helper()
+
+	var scans []TeamScan
+
+	for _, team := range []string{"", "Team 1", "Team 2"} {
+		file, ok := files[team]
+		if !ok {
+			continue
+		}
+
+		run, err := nmap.ParseFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		scans = append(scans, TeamScan{Team: team, Run: run})
+	}
+
+	return scans
+}
+
+func TestImportNmap(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"https.xml": `<nmaprun><host><status state="up"/><address addr="10.0.0.10" addrtype="ipv4"/><ports>
+<port protocol="tcp" portid="443"><state state="open"/><service name="http" tunnel="ssl"/></port>
+<port protocol="tcp" portid="8443"><state state="open"/></port>
+<port protocol="tcp" portid="443"><state state="open"/><service name="http" tunnel="ssl"/></port>
+</ports></host></nmaprun>`,
+	})
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{
+			name:  "without team",
+			files: map[string]string{"": "../sample/nmap/team1.xml"},
+			want: `
+hosts:
+- name: web
+  host: 172.46.64.98
+  ports:
+    ssh: ${web_ssh_port}
+    http: ${web_http_port}
+  attacks: []
+params:
+- name: web_ssh_port
+  value: "22"
+- name: web_http_port
+  value: "80"
+`,
+		},
+		{
+			name: "teams",
+			files: map[string]string{
+				"Team 1": "../sample/nmap/team1.xml",
+				"Team 2": "../sample/nmap/team2.xml",
+			},
+			want: `
+teams:
+- name: Team 1
+  params:
+  - name: web_host
+    value: 172.46.64.98
+  - name: web_ssh_port
+    value: "22"
+  - name: web_http_port
+    value: "80"
+- name: Team 2
+  params:
+  - name: web_host
+    value: 172.46.64.99
+  - name: web_ssh_port
+    value: "22"
+  - name: web_http_port
+    value: "80"
+hosts:
+- name: web
+  host: ${web_host}
+  ports:
+    ssh: ${web_ssh_port}
+    http: ${web_http_port}
+  attacks: []
+`,
+		},
+		{
+			name:  "tunneled service",
+			files: map[string]string{"": filepath.Join(dir, "https.xml")},
+			want: `
+hosts:
+- name: host_10
+  host: 10.0.0.10
+  services:
+  - http
+  ports:
+    https: ${host_10_https_port}
+    tcp8443: ${host_10_tcp8443_port}
+  attacks: []
+params:
+- name: host_10_https_port
+  value: "443"
+- name: host_10_tcp8443_port
+  value: "8443"
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := yaml.Marshal(ImportNmap(parseScans(t, tt.files)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := strings.TrimSpace(string(data)), strings.TrimSpace(tt.want); got != want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestImportNmapRequires(t *testing.T) {
+	data, err := yaml.Marshal(ImportNmap(parseScans(t, map[string]string{"": "../sample/nmap/team1.xml"})))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Load(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host := &s.Hosts[0]
+
+	if err := host.checkRequires(&recipe.Requirements{Services: []string{"ssh", "http"}, Ports: []string{"http"}}); err != nil {
+		t.Error(err)
+	}
+
+	if err := host.checkRequires(&recipe.Requirements{Ports: []string{"mysql"}}); err == nil {
+		t.Error("expected error for filtered port")
+	}
+
+	v, err := newVars(&Team{Name: "Team 1", Index: 1}, s.Params, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params, err := v.host(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if params["port_http"] != "80" || params["port_ssh"] != "22" || params["services"] != "http,ssh" {
+		t.Errorf("host parameters = %v", params)
+	}
+}
+
+func TestResolveNmap(t *testing.T) {
+	s := &Scene{dir: "../sample"}
+
+	tests := []struct {
+		name   string
+		team   *Team
+		nmap   *Nmap
+		params map[string]string
+		addr   string
+		port   string
+		err    string
+	}{
+		{
+			name: "team index file",
+			team: &Team{Name: "Team 2", Index: 2},
+			nmap: &Nmap{File: "nmap/team{x}.xml", Match: "web", Service: "http"},
+			addr: "172.46.64.99",
+			port: "80",
+		},
+		{
+			name:   "explicit port",
+			team:   &Team{Name: "Team 1", Index: 1},
+			nmap:   &Nmap{File: "nmap/team1.xml", Match: "172.46.64.0/24", Service: "http"},
+			params: map[string]string{"target_port": "8080"},
+			addr:   "172.46.64.98",
+			port:   "8080",
+		},
+		{
+			name: "team parameter match",
+			team: &Team{Name: "Team 1", Index: 1, Params: []Param{{Name: "web_ip", Value: "172.46.64.98"}}},
+			nmap: &Nmap{File: "nmap/team1.xml", Match: "${web_ip}", Service: "ssh"},
+			addr: "172.46.64.98",
+			port: "22",
+		},
+		{
+			name: "filtered port",
+			team: &Team{Name: "Team 1", Index: 1},
+			nmap: &Nmap{File: "nmap/team1.xml", Match: "web", Service: "mysql"},
+			err:  "has no open port for service 'mysql'",
+		},
+		{
+			name: "host down",
+			team: &Team{Name: "Team 1", Index: 1},
+			nmap: &Nmap{File: "nmap/team1.xml", Match: "172.46.64.11"},
+			err:  "matching '172.46.64.11' not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := newVars(tt.team, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			params := tt.params
+			if params == nil {
+				params = make(map[string]string)
+			}
+
+			addr, err := s.resolveNmap(v, &Host{Name: "web", Nmap: tt.nmap}, params)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if addr != tt.addr || params["target_port"] != tt.port {
+				t.Errorf("got %s:%s, want %s:%s", addr, params["target_port"], tt.addr, tt.port)
+			}
+		})
+	}
+}
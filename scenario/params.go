@@ -0,0 +1,135 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package scenario
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"vilks.io/vilks/secret"
+)
+
+// envName matches valid environment variable names.
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// check validates parameter value source without reading it, so that scenario
+// can be validated without access to environment variables, files and keys.
+func (p *Param) check() error {
+	switch {
+	case p.FromEnv != "" && p.FromFile != "":
+		return errors.New("only one of from_env and from_file can be set")
+	case p.FromEnv != "" && !envName.MatchString(p.FromEnv):
+		return fmt.Errorf("invalid environment variable name '%s'", p.FromEnv)
+	case p.Key != "" && p.FromFile == "":
+		return errors.New("key can be used only with from_file")
+	case p.Key != "" && slices.Contains(strings.Split(p.Key, "."), ""):
+		return fmt.Errorf("invalid key '%s'", p.Key)
+	}
+
+	return nil
+}
+
+// resolve reads parameter value from environment variable or file.
+func (p *Param) resolve(baseDir string) error {
+	if err := p.check(); err != nil {
+		return err
+	}
+
+	var err error
+
+	switch {
+	case p.FromEnv != "":
+		p.Value, err = secret.FromEnv(p.FromEnv)
+	case p.FromFile != "":
+		path := p.FromFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+
+		p.Value, err = secret.FromFile(path, p.Key)
+	}
+
+	return err
+}
+
+// eachParam calls fn for every scenario parameter with description of its scope.
+func (s *Scenario) eachParam(fn func(kind string, p *Param) error) error {
+	each := func(kind string, params []Param) error {
+		for i := range params {
+			if err := fn(kind, &params[i]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if err := each("global", s.Params); err != nil {
+		return err
+	}
+
+	for _, t := range s.Teams {
+		if err := each(fmt.Sprintf("team '%s'", t.Name), t.Params); err != nil {
+			return err
+		}
+	}
+
+	for _, h := range s.Hosts {
+		if err := each(fmt.Sprintf("host '%s'", h.Name), h.Params); err != nil {
+			return err
+		}
+
+		for _, a := range h.Attacks {
+			if err := each(fmt.Sprintf("host '%s' attack '%s'", h.Name, a.Name), a.Params); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkParams validates value sources of all scenario parameters.
+func (s *Scenario) checkParams() error {
+	return s.eachParam(func(kind string, p *Param) error {
+		if err := p.check(); err != nil {
+			return fmt.Errorf("%s parameter '%s': %w", kind, p.Name, err)
+		}
+
+		return nil
+	})
+}
+
+// resolveParams resolves values of scenario parameters from external sources
+// when resolve is set and adds secret parameter values to masker.
+func (s *Scenario) resolveParams(baseDir string, resolve bool, masker *secret.Masker) error {
+	return s.eachParam(func(kind string, p *Param) error {
+		if resolve {
+			if err := p.resolve(baseDir); err != nil {
+				return fmt.Errorf("%s parameter '%s': %w", kind, p.Name, err)
+			}
+		}
+
+		if p.Secret() {
+			masker.Add(p.Value)
+		}
+
+		return nil
+	})
+}
+
+// MaskSecrets replaces inline values of secret parameters with mask.
+func (s *Scenario) MaskSecrets() {
+	_ = s.eachParam(func(_ string, p *Param) error {
+		if p.Secret() && p.Value != "" {
+			p.Value = secret.Mask
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,103 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package scenario
+
+import (
+	"strings"
+	"testing"
+
+	"vilks.io/vilks/secret"
+)
+
+func TestCheckParams(t *testing.T) {
+	tests := []struct {
+		name  string
+		param Param
+		err   string
+	}{
+		{name: "inline", param: Param{Name: "p", Value: "v"}},
+		{name: "env", param: Param{Name: "p", FromEnv: "VILKS_TEST_UNSET"}},
+		{name: "file", param: Param{Name: "p", FromFile: "missing.age", Key: "db.password"}},
+		{name: "both", param: Param{Name: "p", FromEnv: "A", FromFile: "a.txt"}, err: "only one of from_env and from_file can be set"},
+		{name: "env name", param: Param{Name: "p", FromEnv: "1-A"}, err: "invalid environment variable name '1-A'"},
+		{name: "key without file", param: Param{Name: "p", FromEnv: "A", Key: "a"}, err: "key can be used only with from_file"},
+		{name: "key", param: Param{Name: "p", FromFile: "a.yaml", Key: "a..b"}, err: "invalid key 'a..b'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Scenario{Hosts: []Host{{Name: "web", Attacks: []Attack{{Name: "scan", Params: []Param{tt.param}}}}}}
+
+			err := s.checkParams()
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), "host 'web' attack 'scan' parameter 'p': "+tt.err) {
+				t.Errorf("error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestResolveParams(t *testing.T) {
+	t.Setenv("VILKS_TEST_TOKEN", "t0ken")
+
+	s := &Scenario{
+		Params: []Param{
+			{Name: "password", Value: "inline", Type: "secret"},
+			{Name: "token", FromEnv: "VILKS_TEST_TOKEN", Type: "secret"},
+			{Name: "missing", FromEnv: "VILKS_TEST_UNSET"},
+		},
+	}
+
+	masker := secret.NewMasker()
+
+	if err := s.resolveParams(".", false, masker); err != nil {
+		t.Fatalf("params must not be resolved for validation: %v", err)
+	}
+
+	if s.Params[1].Value != "" || masker.Mask("inline") != secret.Mask {
+		t.Errorf("token = %q, inline secret masked as %q", s.Params[1].Value, masker.Mask("inline"))
+	}
+
+	err := s.resolveParams(".", true, masker)
+	if err == nil || !strings.Contains(err.Error(), "global parameter 'missing': environment variable 'VILKS_TEST_UNSET' is not set") {
+		t.Fatalf("error = %v", err)
+	}
+
+	if s.Params[1].Value != "t0ken" || masker.Mask("t0ken") != secret.Mask {
+		t.Errorf("token = %q, masked as %q", s.Params[1].Value, masker.Mask("t0ken"))
+	}
+}
+
+func TestFilteredSecrets(t *testing.T) {
+	masker := secret.NewMasker("s3cr&t")
+
+	global := []Param{
+		{Name: "password", Value: "s3cr&t", Type: "secret"},
+		{Name: "auth", Value: "${password | base64}"},
+	}
+
+	v, err := newVars(&Team{Name: "Team 1", Index: 1}, global, masker)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v.params["auth"] != "czNjciZ0" {
+		t.Fatalf("auth = %q", v.params["auth"])
+	}
+
+	if _, err := v.expand("curl -d p=${password | urlencode}"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := masker.Mask("auth czNjciZ0 p=s3cr%26t"); got != "auth ****** p=******" {
+		t.Errorf("masked = %q", got)
+	}
+}
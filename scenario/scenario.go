@@ -5,32 +5,46 @@ package scenario
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"strconv"
-	"strings"
+	"time"
 
 	"vilks.io/vilks/evidence"
 	"vilks.io/vilks/executor"
 	"vilks.io/vilks/logger"
 	"vilks.io/vilks/recipe"
+	"vilks.io/vilks/secret"
 )
 
 type Scene struct {
+	runID        string
 	attackerHost string
 	scenario     *Scenario
 	recipes      *recipe.Recipes
 	log          logger.Logger
 	evmgr        *evidence.Manager
+	ports        *executor.PortAllocator
+	secrets      *secret.Masker
+	dir          string
 }
 
-func New(ctx context.Context, log logger.Logger, evidencePath, scenarioPath, recipesDir string) (*Scene, error) {
-	scenario, err := LoadFile(ctx, scenarioPath)
+// New loads scenario merged from files and overrides, see LoadFiles, and recipes.
+func New(ctx context.Context, log logger.Logger, evidencePath string, scenarioPaths, overrides []string, recipesDir string) (*Scene, error) {
+	scenario, err := LoadFiles(ctx, scenarioPaths, overrides)
 	if err != nil {
 		return nil, err
 	}
 
+	// Values from external sources are resolved only before execution, see ResolveParams.
+	secrets := secret.NewMasker()
+	if err := scenario.resolveParams(filepath.Dir(scenarioPaths[0]), false, secrets); err != nil {
+		return nil, err
+	}
+
 	recipes := recipe.New()
 
 	err = filepath.Walk(recipesDir, func(path string, info os.FileInfo, err error) error {
@@ -52,30 +66,230 @@ func New(ctx context.Context, log logger.Logger, evidencePath, scenarioPath, rec
 		return nil, err
 	}
 
+	ports := executor.NewPortAllocator("", 0, 0)
+	if scenario.Ports != nil {
+		ports = executor.NewPortAllocator(scenario.Ports.Bind, scenario.Ports.Start, scenario.Ports.End)
+	}
+
 	return &Scene{
 		scenario: scenario,
 		recipes:  recipes,
-		log:      log,
+		log:      logger.Masked(log, secrets),
 		evmgr:    evidence.New(evidencePath),
+		ports:    ports,
+		secrets:  secrets,
+		dir:      filepath.Dir(scenarioPaths[0]),
 	}, nil
 }
 
+// ResolveParams reads parameter values from environment variables and files.
+// Scenario can be validated without them, so that secrets are not needed to
+// validate it.
+func (s *Scene) ResolveParams() error {
+	return s.scenario.resolveParams(s.dir, true, s.secrets)
+}
+
 func (s *Scene) Validate(_ context.Context) error {
+	if err := s.scenario.checkParams(); err != nil {
+		return err
+	}
+
+	if p := s.scenario.Ports; p != nil {
+		if (p.Start == 0) != (p.End == 0) || p.Start < 0 || p.End > 65535 || p.Start > p.End {
+			return fmt.Errorf("invalid port range %d-%d", p.Start, p.End)
+		}
+
+		if p.Bind != "" && net.ParseIP(p.Bind) == nil {
+			return fmt.Errorf("invalid bind address '%s'", p.Bind)
+		}
+	}
+
+	if err := s.scenario.Resources.Validate(); err != nil {
+		return fmt.Errorf("resources: %w", err)
+	}
+
+	if scope := s.scenario.Scope; scope != nil {
+		for _, r := range scope.Allow {
+			if err := r.validate(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if e := s.scenario.Engagement; e != nil {
+		if err := e.validate(); err != nil {
+			return err
+		}
+	}
+
 	for _, h := range s.scenario.Hosts {
 		for _, a := range h.Attacks {
-			if s.recipes.Get(a.Recipe) == nil {
+			r := s.recipes.Get(a.Recipe)
+			if r == nil {
 				return fmt.Errorf("recipe '%s' not found", a.Recipe)
 			}
+
+			if err := r.Validate(); err != nil {
+				return fmt.Errorf("recipe '%s': %w", a.Recipe, err)
+			}
+
+			if err := h.checkRequires(r.Requires); err != nil {
+				return fmt.Errorf("host '%s' attack '%s': recipe '%s' %w", h.Name, a.Name, a.Recipe, err)
+			}
+
+			for _, name := range r.Privileged() {
+				s.log.Warn(fmt.Sprintf("Recipe '%s' used by host '%s' attack '%s' requests privileged mode for '%s'", a.Recipe, h.Name, a.Name, name))
+			}
+		}
+	}
+
+	for i := range s.scenario.Teams {
+		if err := s.validateTeam(&s.scenario.Teams[i]); err != nil {
+			return fmt.Errorf("team '%s': %w", s.scenario.Teams[i].Name, err)
+		}
+	}
+
+	return nil
+}
+
+// validateTeam checks that scenario values can be expanded for the team.
+func (s *Scene) validateTeam(team *Team) error {
+	vars, err := newVars(team, s.scenario.Params, s.secrets)
+	if err != nil {
+		return err
+	}
+
+	for i := range s.scenario.Hosts {
+		host := &s.scenario.Hosts[i]
+
+		if _, err := vars.target(host); err != nil {
+			return err
+		}
+
+		for j := range host.Attacks {
+			if _, _, err := vars.forAttack(host, &host.Attacks[j]); err != nil {
+				return err
+			}
+
+			if err := s.validatePorts(team, host.Attacks[j].Recipe); err != nil {
+				return err
+			}
+		}
+
+		if _, err := vars.host(host); err != nil {
+			return err
+		}
+
+		if host.Nmap != nil {
+			if _, _, err := vars.nmap(host); err != nil {
+				return err
+			}
+		} else if host.Target == "" {
+			return fmt.Errorf("host '%s' has no target", host.Name)
+		}
+	}
+
+	if n := s.scenario.Network; n != nil {
+		address := n.Address
+		if team.Address != "" {
+			address = team.Address
+		}
+
+		if _, err := vars.expand(address); err != nil {
+			return fmt.Errorf("network address: %w", err)
+		}
+
+		if address != "" {
+			if err := s.validateConcurrency(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if scope := s.scenario.Scope; scope != nil {
+		ts, err := scope.forTeam(team, vars.expand)
+		if err != nil {
+			return err
+		}
+
+		for _, r := range ts.rules {
+			for _, c := range r.CIDRs {
+				if _, err := parseCIDR(c); err != nil {
+					return err
+				}
+			}
 		}
 	}
 
 	return nil
 }
 
+// validateConcurrency checks that no step of used recipes runs iterations
+// concurrently as static network address can be assigned to one container only.
+func (s *Scene) validateConcurrency() error {
+	for _, h := range s.scenario.Hosts {
+		for _, a := range h.Attacks {
+			r := s.recipes.Get(a.Recipe)
+			if r == nil {
+				continue
+			}
+
+			for _, step := range r.Steps {
+				if l := step.Loop(); l != nil && l.Concurrency > 1 {
+					return fmt.Errorf("recipe '%s' step '%s' concurrency can not be used with static network address", a.Recipe, step.Name)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// validatePorts checks that team service ports of recipe are in valid range.
+func (s *Scene) validatePorts(team *Team, name string) error {
+	r := s.recipes.Get(name)
+	if r == nil {
+		return nil
+	}
+
+	for _, svc := range r.Services {
+		for _, p := range svc.Ports {
+			if port := p.Base + team.Index; p.Base > 0 && port > 65535 {
+				return fmt.Errorf("recipe '%s' service '%s' port '%s' %d is out of range 1-65535", name, svc.Name, p.Name, port)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Secrets returns masker for secret parameter values.
+func (s *Scene) Secrets() *secret.Masker {
+	return s.secrets
+}
+
 func (s *Scene) SetAttackerHost(host string) {
 	s.attackerHost = host
 }
 
+func (s *Scene) SetRunID(id string) {
+	s.runID = id
+}
+
+// CheckEngagement checks if attacks on host by team are allowed by rules of engagement.
+func (s *Scene) CheckEngagement(ctx context.Context, teamName, hostName string) error {
+	e := s.scenario.Engagement
+	if e == nil {
+		return nil
+	}
+
+	if err := e.Allowed(teamName, hostName, time.Now()); err != nil {
+		return err
+	}
+
+	return e.CheckKillSwitches(ctx, hostName)
+}
+
 func (s *Scene) Teams() []Team {
 	return s.scenario.Teams
 }
@@ -149,48 +363,95 @@ func (s *Scene) Execute(ctx context.Context, teamName, hostName, attackName stri
 		return fmt.Errorf("host '%s' attack '%s' not found", hostName, attackName)
 	}
 
+	if err := s.CheckEngagement(ctx, team.Name, host.Name); err != nil {
+		return fmt.Errorf("attack refused: %w", err)
+	}
+
 	ex := executor.New(s.log, s.evmgr.Attack(team.Name, host.Name), s.recipes)
+	ex.RunID = s.runID
+	ex.Ports = s.ports
+	ex.Resources = s.scenario.Resources
+	ex.Secrets = s.secrets
 	ex.AttackerHost = s.attackerHost
+	ex.HostName = host.Name
 
-	ex.TeamName = team.Name
-	ex.TeamIndex = strconv.FormatInt(int64(team.Index), 10)
-	ex.TeamParams = make(map[string]string, len(team.Params))
-	for _, prm := range team.Params {
-		ex.TeamParams[prm.Name] = prm.Value
+	teamVars, err := newVars(team, s.scenario.Params, s.secrets)
+	if err != nil {
+		return err
 	}
 
+	vars, params, err := teamVars.forAttack(host, attack)
+	if err != nil {
+		return err
+	}
+
+	ex.TeamName = team.Name
+	ex.TeamIndex = strconv.FormatInt(int64(team.Index), 10)
+	ex.TeamParams = vars.team
 	ex.AttackName = attack.Name
+	ex.GlobalParams = vars.global
 
-	ex.GlobalParams = make(map[string]string, len(s.scenario.Params))
-	for _, prm := range s.scenario.Params {
-		ex.GlobalParams[prm.Name] = prm.Value
+	target, err := vars.target(host)
+	if err != nil {
+		return err
 	}
 
-	ti1 := ex.TeamIndex
-	ti2 := ti1
-	if len(ti2) == 1 {
-		ti2 = "0" + ti1
+	if ex.HostParams, err = vars.host(host); err != nil {
+		return err
 	}
-	ti3 := ti2
-	if len(ti3) == 2 {
-		ti3 = "0" + ti2
+
+	// Use host port of the first port required by recipe as target port.
+	if r := s.recipes.Get(attack.Recipe); r != nil && r.Requires != nil && len(r.Requires.Ports) > 0 {
+		if _, ok := params["target_port"]; !ok {
+			if port, ok := ex.HostParams["port_"+r.Requires.Ports[0]]; ok {
+				params["target_port"] = port
+			}
+		}
 	}
 
-	target := strings.ReplaceAll(host.Target, "{x}", ti1)
-	target = strings.ReplaceAll(target, "{xx}", ti2)
-	target = strings.ReplaceAll(target, "{xxx}", ti3)
+	if host.Nmap != nil {
+		addr, err := s.resolveNmap(vars, host, params)
+		if err != nil {
+			return err
+		}
 
-	// Allow to use team parameters in target.
-	for k, v := range ex.TeamParams {
-		target = strings.ReplaceAll(target, "${"+k+"}", v)
+		// Explicit target takes precedence over scanned address.
+		if target == "" {
+			target = addr
+		}
 	}
 
-	params := make(map[string]string, len(attack.Params))
+	if n := s.scenario.Network; n != nil {
+		address := n.Address
+		if team.Address != "" {
+			address = team.Address
+		}
+
+		ex.Network = n.Name
+		if ex.NetworkAddress, err = vars.expand(address); err != nil {
+			return fmt.Errorf("network address: %w", err)
+		}
+	}
+
+	if scope := s.scenario.Scope; scope != nil {
+		ts, err := scope.forTeam(team, vars.expand)
+		if err != nil {
+			return err
+		}
+
+		if err := ts.Check(ctx, target, s.targetPort(attack, params)); err != nil {
+			return fmt.Errorf("attack refused: %w", err)
+		}
+
+		if scope.Enforce {
+			egress, err := ts.Egress(ctx)
+			if err != nil {
+				return err
+			}
 
-	for _, prm := range attack.Params {
-		params[prm.Name] = strings.ReplaceAll(prm.Value, "{x}", ti1)
-		params[prm.Name] = strings.ReplaceAll(params[prm.Name], "{xx}", ti2)
-		params[prm.Name] = strings.ReplaceAll(params[prm.Name], "{xxx}", ti3)
+			ex.RestrictEgress = true
+			ex.Egress = egress
+		}
 	}
 
 	if err := ex.AddAttack(target, attack.Recipe, params); err != nil {
@@ -201,5 +462,40 @@ func (s *Scene) Execute(ctx context.Context, teamName, hostName, attackName stri
 		return err
 	}
 
-	return ex.Execute(ctx)
+	if e := s.scenario.Engagement; e != nil {
+		var cancel context.CancelCauseFunc
+
+		ctx, cancel = context.WithCancelCause(ctx)
+		defer cancel(nil)
+
+		e.watch(ctx, host.Name, func(err error) {
+			s.log.Error(fmt.Sprintf("Aborting attack '%s' on host '%s' for team '%s': %s", attack.Name, host.Name, team.Name, err.Error()))
+			cancel(err)
+		})
+	}
+
+	if err := ex.Execute(ctx); err != nil {
+		var ks *ErrKillSwitch
+		if cause := context.Cause(ctx); errors.As(cause, &ks) {
+			return cause
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// targetPort returns target port from attack parameters or recipe default.
+func (s *Scene) targetPort(attack *Attack, params map[string]string) int {
+	port, ok := params["target_port"]
+	if !ok {
+		if r := s.recipes.Get(attack.Recipe); r != nil && r.Params["target_port"] != nil {
+			port = r.Params["target_port"].Default
+		}
+	}
+
+	p, _ := strconv.Atoi(port)
+
+	return p
 }
@@ -0,0 +1,258 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package scenario
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"vilks.io/vilks/runner"
+)
+
+// Scope limits destinations attacks are allowed to reach.
+type Scope struct {
+	// Enforce is a flag indicating if step container egress should be restricted to the scope by firewall rules.
+	Enforce bool `json:"enforce"`
+	// Allow is the list of allowed destinations.
+	Allow []ScopeRule `json:"allow"`
+}
+
+// ScopeRule is an allowed destination. Team index placeholders can be used in CIDRs and hosts.
+type ScopeRule struct {
+	// Teams is the list of team names rule applies to, rule applies to all teams if empty.
+	Teams []string `json:"teams,omitempty"`
+	// CIDRs is the list of allowed networks in CIDR notation or single IP addresses.
+	CIDRs []string `json:"cidrs,omitempty"`
+	// Hosts is the list of allowed host names, wildcards are supported.
+	Hosts []string `json:"hosts,omitempty"`
+	// Ports is the list of allowed ports or port ranges, all ports are allowed if empty.
+	Ports []string `json:"ports,omitempty"`
+}
+
+func (r *ScopeRule) validate() error {
+	for _, c := range r.CIDRs {
+		if _, err := parseCIDR(c); err != nil && !strings.Contains(c, "{") {
+			return err
+		}
+	}
+
+	for _, p := range r.Ports {
+		if _, _, err := parsePortRange(p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *ScopeRule) allowsPort(port int) bool {
+	if len(r.Ports) == 0 || port == 0 {
+		return true
+	}
+
+	for _, p := range r.Ports {
+		from, to, err := parsePortRange(p)
+		if err == nil && port >= from && port <= to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// teamScope is a scope resolved for a single team.
+type teamScope struct {
+	rules []ScopeRule
+}
+
+func (s *Scope) forTeam(team *Team, expand func(string) (string, error)) (*teamScope, error) {
+	ts := &teamScope{}
+
+	for _, r := range s.Allow {
+		if len(r.Teams) > 0 && !slices.Contains(r.Teams, team.Name) {
+			continue
+		}
+
+		rule := ScopeRule{
+			Ports: r.Ports,
+			CIDRs: make([]string, 0, len(r.CIDRs)),
+			Hosts: make([]string, 0, len(r.Hosts)),
+		}
+
+		for _, c := range r.CIDRs {
+			cidr, err := expand(c)
+			if err != nil {
+				return nil, fmt.Errorf("scope network '%s': %w", c, err)
+			}
+
+			rule.CIDRs = append(rule.CIDRs, cidr)
+		}
+
+		for _, h := range r.Hosts {
+			host, err := expand(h)
+			if err != nil {
+				return nil, fmt.Errorf("scope host '%s': %w", h, err)
+			}
+
+			rule.Hosts = append(rule.Hosts, strings.ToLower(host))
+		}
+
+		ts.rules = append(ts.rules, rule)
+	}
+
+	return ts, nil
+}
+
+// Check checks if host and port are in the scope. Host names that are not
+// explicitly allowed must resolve only to addresses in allowed networks.
+func (ts *teamScope) Check(ctx context.Context, host string, port int) error {
+	host = strings.ToLower(host)
+
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		for _, r := range ts.rules {
+			if !r.allowsPort(port) {
+				continue
+			}
+
+			for _, h := range r.Hosts {
+				if ok, _ := path.Match(h, host); ok {
+					return nil
+				}
+			}
+		}
+
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return fmt.Errorf("target '%s' can not be resolved to check scope: %w", host, err)
+		}
+
+		ips = ips[:0]
+		for _, a := range addrs {
+			ips = append(ips, a.IP)
+		}
+	}
+
+	for _, ip := range ips {
+		if !ts.allowsIP(ip, port) {
+			if port > 0 {
+				return fmt.Errorf("target '%s' (%s) port %d is out of scope", host, ip, port)
+			}
+
+			return fmt.Errorf("target '%s' (%s) is out of scope", host, ip)
+		}
+	}
+
+	return nil
+}
+
+func (ts *teamScope) allowsIP(ip net.IP, port int) bool {
+	for _, r := range ts.rules {
+		if !r.allowsPort(port) {
+			continue
+		}
+
+		for _, c := range r.CIDRs {
+			n, err := parseCIDR(c)
+			if err == nil && n.Contains(ip) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Egress returns firewall rules for step and service containers.
+func (ts *teamScope) Egress(ctx context.Context) ([]runner.EgressRule, error) {
+	rules := make([]runner.EgressRule, 0, len(ts.rules))
+
+	for _, r := range ts.rules {
+		networks := make([]string, 0, len(r.CIDRs)+len(r.Hosts))
+
+		for _, c := range r.CIDRs {
+			n, err := parseCIDR(c)
+			if err != nil {
+				return nil, err
+			}
+
+			networks = append(networks, n.String())
+		}
+
+		for _, h := range r.Hosts {
+			// Wildcard host names can not be resolved to addresses.
+			if strings.ContainsAny(h, "*?[") {
+				continue
+			}
+
+			addrs, err := net.DefaultResolver.LookupIPAddr(ctx, h)
+			if err != nil {
+				return nil, fmt.Errorf("scope host '%s' can not be resolved: %w", h, err)
+			}
+
+			for _, a := range addrs {
+				if ip := a.IP.To4(); ip != nil {
+					networks = append(networks, ip.String()+"/32")
+				} else {
+					networks = append(networks, a.IP.String()+"/128")
+				}
+			}
+		}
+
+		for _, n := range networks {
+			rules = append(rules, runner.EgressRule{
+				Network: n,
+				Ports:   r.Ports,
+			})
+		}
+	}
+
+	return rules, nil
+}
+
+func parseCIDR(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid scope address '%s'", s)
+		}
+
+		if ip.To4() != nil {
+			s += "/32"
+		} else {
+			s += "/128"
+		}
+	}
+
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scope network '%s'", s)
+	}
+
+	return n, nil
+}
+
+func parsePortRange(s string) (int, int, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		to = from
+	}
+
+	f, err := strconv.Atoi(strings.TrimSpace(from))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid scope port '%s'", s)
+	}
+
+	t, err := strconv.Atoi(strings.TrimSpace(to))
+	if err != nil || f < 1 || t > 65535 || f > t {
+		return 0, 0, fmt.Errorf("invalid scope port '%s'", s)
+	}
+
+	return f, t, nil
+}
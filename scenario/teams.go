@@ -0,0 +1,315 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package scenario
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// TeamGenerator generates teams, team index expressions like {index} or
+// {xx} can be used in name, address and parameter values.
+type TeamGenerator struct {
+	// Count is the number of teams to generate.
+	Count int `json:"count"`
+	// Start is the index of the first team, defaults to 1.
+	Start int `json:"start,omitempty"`
+	// Name is the team name.
+	Name string `json:"name"`
+	// Address is the static IP address of the team step containers.
+	Address string `json:"address,omitempty"`
+	// Params are the team parameters.
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// teamsSpec is the tree key that holds teams specification while scenario
+// files are merged and overrides applied, so generators can be overridden.
+const teamsSpec = ".teams"
+
+// splitTeams moves teams specification in form {import: files, generate: generators}
+// out of the teams list, so that it is merged separately from explicit teams.
+func splitTeams(tree map[string]any) error {
+	spec, ok := tree["teams"].(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	for k := range spec {
+		if k != "import" && k != "generate" {
+			return fmt.Errorf("unknown teams option '%s'", k)
+		}
+	}
+
+	delete(tree, "teams")
+
+	tree[teamsSpec] = spec
+
+	return nil
+}
+
+// expandTeams replaces teams specification with list of imported and
+// generated teams, explicit teams are merged over them by name. Imported
+// file paths are relative to dir.
+func expandTeams(tree map[string]any, dir string) error {
+	spec, ok := tree[teamsSpec].(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	delete(tree, teamsSpec)
+
+	teams := make([]any, 0)
+
+	for _, path := range listOf(spec["import"]) {
+		p, ok := path.(string)
+		if !ok {
+			return fmt.Errorf("invalid teams import '%v'", path)
+		}
+
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+
+		imported, err := importTeams(p)
+		if err != nil {
+			return fmt.Errorf("failed to import teams from '%s': %w", p, err)
+		}
+
+		teams = append(teams, imported...)
+	}
+
+	for _, g := range listOf(spec["generate"]) {
+		data, err := yaml.Marshal(g)
+		if err != nil {
+			return err
+		}
+
+		var gen TeamGenerator
+		if err := yaml.Unmarshal(data, &gen); err != nil {
+			return fmt.Errorf("invalid teams generator: %w", err)
+		}
+
+		generated, err := gen.generate()
+		if err != nil {
+			return err
+		}
+
+		teams = append(teams, generated...)
+	}
+
+	tree["teams"] = merge(teams, tree["teams"])
+
+	return nil
+}
+
+func listOf(v any) []any {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []any:
+		return v
+	default:
+		return []any{v}
+	}
+}
+
+func (g *TeamGenerator) generate() ([]any, error) {
+	if g.Count <= 0 || g.Name == "" {
+		return nil, fmt.Errorf("teams generator must have positive count and name")
+	}
+
+	start := g.Start
+	if start == 0 {
+		start = 1
+	}
+
+	names := make([]string, 0, len(g.Params))
+	for name := range g.Params {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	teams := make([]any, 0, g.Count)
+
+	for i := start; i < start+g.Count; i++ {
+		v := &vars{index: i}
+
+		name, err := v.expandIndex(g.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		// Address and parameters are expanded with the final team index,
+		// which can be overridden, so they are only checked here.
+		if _, err := v.expandIndex(g.Address); err != nil {
+			return nil, err
+		}
+
+		for _, k := range names {
+			if _, err := v.expandIndex(g.Params[k]); err != nil {
+				return nil, fmt.Errorf("team '%s' parameter '%s': %w", name, k, err)
+			}
+		}
+
+		teams = append(teams, teamItem(name, i, g.Address, names, g.Params))
+	}
+
+	return teams, nil
+}
+
+// teamItem returns team in scenario document form.
+func teamItem(name string, index int, address string, names []string, params map[string]string) map[string]any {
+	prms := make([]any, 0, len(names))
+	for _, k := range names {
+		prms = append(prms, map[string]any{"name": k, "value": params[k]})
+	}
+
+	team := map[string]any{
+		"name":   name,
+		"index":  index,
+		"params": prms,
+	}
+
+	if address != "" {
+		team["address"] = address
+	}
+
+	return team
+}
+
+// importTeams reads teams from CSV file with header or JSON array of objects.
+// Columns or keys other than name, index and address are team parameters.
+func importTeams(path string) ([]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		rows    []map[string]string
+		columns []string
+	)
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		var items []map[string]any
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil, err
+		}
+
+		for _, item := range items {
+			// Parameters can be also provided as nested object.
+			if prms, ok := item["params"].(map[string]any); ok {
+				delete(item, "params")
+
+				for k, v := range prms {
+					item[k] = v
+				}
+			}
+
+			row := make(map[string]string, len(item))
+			for k, v := range item {
+				val, ok := v.(string)
+				if !ok {
+					data, err := json.Marshal(v)
+					if err != nil {
+						return nil, err
+					}
+
+					val = string(data)
+				}
+
+				row[k] = val
+
+				if !slices.Contains(columns, k) {
+					columns = append(columns, k)
+				}
+			}
+
+			rows = append(rows, row)
+		}
+
+		slices.Sort(columns)
+	} else {
+		records, err := csv.NewReader(strings.NewReader(string(data))).ReadAll()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(records) == 0 {
+			return nil, nil
+		}
+
+		columns = records[0]
+		for i := range columns {
+			columns[i] = strings.TrimSpace(columns[i])
+		}
+
+		for _, rec := range records[1:] {
+			row := make(map[string]string, len(columns))
+			for i, c := range columns {
+				row[c] = strings.TrimSpace(rec[i])
+			}
+
+			rows = append(rows, row)
+		}
+	}
+
+	names := make([]string, 0, len(columns))
+	for _, c := range columns {
+		if c != "name" && c != "index" && c != "address" {
+			names = append(names, c)
+		}
+	}
+
+	teams := make([]any, 0, len(rows))
+
+	for i, row := range rows {
+		if row["name"] == "" {
+			return nil, fmt.Errorf("team %d has no name", i+1)
+		}
+
+		index, err := strconv.Atoi(row["index"])
+		if err != nil {
+			return nil, fmt.Errorf("team '%s' has invalid index '%s'", row["name"], row["index"])
+		}
+
+		teams = append(teams, teamItem(row["name"], index, row["address"], names, row))
+	}
+
+	return teams, nil
+}
+
+// validateTeams checks that team names and indexes are unique.
+func (s *Scenario) validateTeams() error {
+	names := make(map[string]bool, len(s.Teams))
+	indexes := make(map[int]string, len(s.Teams))
+
+	for _, t := range s.Teams {
+		if t.Name == "" {
+			return fmt.Errorf("team with index %d has no name", t.Index)
+		}
+
+		if names[t.Name] {
+			return fmt.Errorf("duplicate team name '%s'", t.Name)
+		}
+
+		if other, ok := indexes[t.Index]; ok {
+			return fmt.Errorf("teams '%s' and '%s' have the same index %d", other, t.Name, t.Index)
+		}
+
+		names[t.Name] = true
+		indexes[t.Index] = t.Name
+	}
+
+	return nil
+}
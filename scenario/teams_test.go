@@ -0,0 +1,336 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package scenario
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandTeams(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"teams.csv": "name, index, web_host\nRed, 1, 10.0.1.5\nBlue, 2, 10.0.2.5\n",
+		"teams.json": `[
+  {"name": "Green", "index": 3, "address": "10.3.0.{x}", "params": {"web_host": "10.0.3.5", "port": 8080}}
+]`,
+		"invalid.csv": "name,index\nRed,first\n",
+	})
+
+	tests := []struct {
+		name string
+		tree string
+		want string
+		err  string
+	}{
+		{
+			name: "list",
+			tree: `
+teams:
+- name: Team 1
+  index: 1
+`,
+			want: `
+teams:
+- name: Team 1
+  index: 1
+`,
+		},
+		{
+			name: "generator",
+			tree: `
+teams:
+  generate:
+    count: 2
+    start: 9
+    name: Team {xx}
+    address: 10.{index}.0.{x}
+    params:
+      web_host: 10.0.{index*2+1:3}.5
+      domain: lab
+`,
+			want: `
+teams:
+- name: Team 09
+  index: 9
+  address: 10.{index}.0.{x}
+  params:
+  - name: domain
+    value: lab
+  - name: web_host
+    value: 10.0.{index*2+1:3}.5
+- name: Team 10
+  index: 10
+  address: 10.{index}.0.{x}
+  params:
+  - name: domain
+    value: lab
+  - name: web_host
+    value: 10.0.{index*2+1:3}.5
+`,
+		},
+		{
+			name: "import",
+			tree: `
+teams:
+  import: [teams.csv, teams.json]
+`,
+			want: `
+teams:
+- name: Red
+  index: 1
+  params:
+  - name: web_host
+    value: 10.0.1.5
+- name: Blue
+  index: 2
+  params:
+  - name: web_host
+    value: 10.0.2.5
+- name: Green
+  index: 3
+  address: 10.3.0.{x}
+  params:
+  - name: port
+    value: "8080"
+  - name: web_host
+    value: 10.0.3.5
+`,
+		},
+		{
+			name: "import and generate",
+			tree: `
+teams:
+  import: teams.csv
+  generate:
+  - count: 1
+    start: 3
+    name: Team {index}
+`,
+			want: `
+teams:
+- name: Red
+  index: 1
+  params:
+  - name: web_host
+    value: 10.0.1.5
+- name: Blue
+  index: 2
+  params:
+  - name: web_host
+    value: 10.0.2.5
+- name: Team 3
+  index: 3
+  params: []
+`,
+		},
+		{
+			name: "unknown option",
+			tree: "teams:\n  count: 3\n",
+			err:  "unknown teams option 'count'",
+		},
+		{
+			name: "missing count",
+			tree: "teams:\n  generate:\n    name: Team {x}\n",
+			err:  "teams generator must have positive count and name",
+		},
+		{
+			name: "invalid index expression",
+			tree: "teams:\n  generate:\n    count: 1\n    name: Team {x}\n    params:\n      a: '{index/0}'\n",
+			err:  "team 'Team 1' parameter 'a': division by zero",
+		},
+		{
+			name: "invalid import index",
+			tree: "teams:\n  import: invalid.csv\n",
+			err:  "team 'Red' has invalid index 'first'",
+		},
+		{
+			name: "missing import",
+			tree: "teams:\n  import: missing.csv\n",
+			err:  "failed to import teams",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := parseTree(t, tt.tree)
+
+			err := splitTeams(tree)
+			if err == nil {
+				err = expandTeams(tree, dir)
+			}
+
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assertTree(t, tree, tt.want)
+		})
+	}
+}
+
+func TestValidateTeams(t *testing.T) {
+	tests := []struct {
+		name  string
+		teams []Team
+		err   string
+	}{
+		{
+			name:  "unique",
+			teams: []Team{{Name: "Team 1", Index: 1}, {Name: "Team 2", Index: 2}},
+		},
+		{
+			name:  "duplicate name",
+			teams: []Team{{Name: "Team 1", Index: 1}, {Name: "Team 1", Index: 2}},
+			err:   "duplicate team name 'Team 1'",
+		},
+		{
+			name:  "duplicate index",
+			teams: []Team{{Name: "Team 1", Index: 1}, {Name: "Team 2", Index: 1}},
+			err:   "teams 'Team 1' and 'Team 2' have the same index 1",
+		},
+		{
+			name:  "no name",
+			teams: []Team{{Index: 3}},
+			err:   "team with index 3 has no name",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Scenario{Teams: tt.teams}
+
+			err := s.validateTeams()
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestLoadFilesTeams(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"scenario.yaml": `
+include: teams/teams.yaml
+hosts:
+- name: web
+  host: ${web_host}
+`,
+		"teams/teams.yaml": `
+teams:
+  import: red.csv
+  generate:
+  - count: 2
+    name: Team {index}
+    params:
+      web_host: 10.0.{index}.5
+`,
+		"teams/red.csv": "name,index,web_host\nRed,10,10.0.10.5\n",
+		"overlay.yaml": `
+teams:
+- name: Red
+  params:
+  - name: domain
+    value: red.lab
+`,
+	})
+
+	tests := []struct {
+		name      string
+		overrides []string
+		want      map[string]string
+		err       string
+	}{
+		{
+			name: "generated",
+			want: map[string]string{"Red": "10:10.0.10.5", "Team 1": "1:10.0.1.5", "Team 2": "2:10.0.2.5"},
+		},
+		{
+			name:      "generator count and start",
+			overrides: []string{"teams.generate.0.count=3", "teams.generate.0.start=4"},
+			want:      map[string]string{"Red": "10:10.0.10.5", "Team 4": "4:10.0.4.5", "Team 5": "5:10.0.5.5", "Team 6": "6:10.0.6.5"},
+		},
+		{
+			name:      "generator parameter",
+			overrides: []string{"teams.generate.0.params.web_host=172.16.{index}.5"},
+			want:      map[string]string{"Red": "10:10.0.10.5", "Team 1": "1:172.16.1.5", "Team 2": "2:172.16.2.5"},
+		},
+		{
+			name:      "generated team index",
+			overrides: []string{"teams.Team 2.index=7"},
+			want:      map[string]string{"Red": "10:10.0.10.5", "Team 1": "1:10.0.1.5", "Team 2": "7:10.0.7.5"},
+		},
+		{
+			name:      "generated team parameter",
+			overrides: []string{"teams.Team 1.params.web_host=192.168.0.5"},
+			want:      map[string]string{"Red": "10:10.0.10.5", "Team 1": "1:192.168.0.5", "Team 2": "2:10.0.2.5"},
+		},
+		{
+			name:      "duplicate index",
+			overrides: []string{"teams.generate.0.start=9"},
+			err:       "teams 'Red' and 'Team 10' have the same index 10",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := LoadFiles(context.Background(), []string{filepath.Join(dir, "scenario.yaml"), filepath.Join(dir, "overlay.yaml")}, tt.overrides)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make(map[string]string, len(s.Teams))
+
+			for i := range s.Teams {
+				team := &s.Teams[i]
+
+				v, err := newVars(team, s.Params, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				got[team.Name] = v.builtin["team_index"] + ":" + v.params["web_host"]
+
+				if team.Name == "Red" && v.params["domain"] != "red.lab" {
+					t.Errorf("team 'Red' domain = %q, want red.lab", v.params["domain"])
+				}
+			}
+
+			if len(got) != len(tt.want) {
+				t.Errorf("got teams %v, want %v", got, tt.want)
+			}
+
+			for name, want := range tt.want {
+				if got[name] != want {
+					t.Errorf("team '%s' = %q, want %q", name, got[name], want)
+				}
+			}
+		})
+	}
+}
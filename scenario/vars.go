@@ -0,0 +1,385 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package scenario
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"vilks.io/vilks/secret"
+	"vilks.io/vilks/template"
+)
+
+// indexExpr matches team index expressions: {x}, {xx}, {xxx} for index
+// zero-padded to the number of x characters, and {index} with optional
+// arithmetic and padding width, e.g. {index+10} or {index*2+1:3}.
+var indexExpr = regexp.MustCompile(`\{(x+|index(?:\s*[-+*/]\s*\d+)*(?:\s*:\s*\d+)?)\}`)
+
+// vars substitutes team index expressions and ${name} parameter references
+// in scenario values in a single consistent way.
+type vars struct {
+	index  int
+	params map[string]string
+
+	// builtin are the team name and index parameters.
+	builtin map[string]string
+	// defs are the parameter definitions vars were resolved from.
+	defs []definition
+
+	// global and team are the expanded global and team parameters.
+	global map[string]string
+	team   map[string]string
+
+	// secrets masks filtered values of secret parameters.
+	secrets *secret.Masker
+}
+
+type paramScope int
+
+const (
+	scopeGlobal paramScope = iota
+	scopeTeam
+	scopeAttack
+)
+
+// definition is a parameter definition of global, team or attack scope.
+type definition struct {
+	param *Param
+	scope paramScope
+	// desc describes parameter in error messages.
+	desc string
+}
+
+// newVars returns variables for the team. Global and team parameter values
+// can contain team index expressions and reference each other, team name and
+// index. Team parameters are available by name and with "team_" prefix, they
+// take precedence over global parameters with the same name.
+func newVars(team *Team, global []Param, secrets *secret.Masker) (*vars, error) {
+	v := &vars{
+		index:   team.Index,
+		secrets: secrets,
+		builtin: map[string]string{
+			"team_name":  team.Name,
+			"team_index": strconv.Itoa(team.Index),
+		},
+	}
+
+	defs := make([]definition, 0, len(global)+len(team.Params))
+
+	for i := range global {
+		defs = append(defs, definition{
+			param: &global[i],
+			scope: scopeGlobal,
+			desc:  fmt.Sprintf("global parameter '%s'", global[i].Name),
+		})
+	}
+
+	for i := range team.Params {
+		defs = append(defs, definition{
+			param: &team.Params[i],
+			scope: scopeTeam,
+			desc:  fmt.Sprintf("team '%s' parameter '%s'", team.Name, team.Params[i].Name),
+		})
+	}
+
+	if _, err := v.resolve(defs); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// forAttack returns variables of the attack and expanded attack parameters.
+// Attack parameters are resolved together with global and team parameters and
+// take precedence over them.
+func (v *vars) forAttack(host *Host, attack *Attack) (*vars, map[string]string, error) {
+	av := &vars{
+		index:   v.index,
+		builtin: v.builtin,
+		secrets: v.secrets,
+	}
+
+	defs := slices.Clone(v.defs)
+
+	for i := range attack.Params {
+		defs = append(defs, definition{
+			param: &attack.Params[i],
+			scope: scopeAttack,
+			desc:  fmt.Sprintf("host '%s' attack '%s' parameter '%s'", host.Name, attack.Name, attack.Params[i].Name),
+		})
+	}
+
+	values, err := av.resolve(defs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	params := make(map[string]string, len(attack.Params))
+
+	for i := len(v.defs); i < len(defs); i++ {
+		params[defs[i].param.Name] = values[i]
+	}
+
+	return av, params, nil
+}
+
+// target returns expanded host target.
+func (v *vars) target(host *Host) (string, error) {
+	target, err := v.expand(host.Target)
+	if err != nil {
+		return "", fmt.Errorf("host '%s' target: %w", host.Name, err)
+	}
+
+	return target, nil
+}
+
+// resolve expands parameter definitions in dependency order, so that parameters
+// can reference each other regardless of scope and declaration order, and
+// returns their values. Later definitions take precedence over earlier ones
+// with the same name, parameter referencing its own name gets value of the
+// definition it overrides.
+func (v *vars) resolve(defs []definition) ([]string, error) {
+	names := make(map[string][]int, len(defs))
+
+	for i, d := range defs {
+		names[d.param.Name] = append(names[d.param.Name], i)
+
+		if d.scope == scopeTeam {
+			names["team_"+d.param.Name] = append(names["team_"+d.param.Name], i)
+		}
+	}
+
+	// target returns index of definition referenced by name from definition i.
+	target := func(i int, name string) int {
+		candidates, ok := names[name]
+		if !ok {
+			for k, c := range names {
+				if strings.EqualFold(k, name) {
+					candidates = c
+				}
+			}
+		}
+
+		if slices.Contains(candidates, i) {
+			candidates = candidates[:slices.Index(candidates, i)]
+		}
+
+		if len(candidates) == 0 {
+			return -1
+		}
+
+		return candidates[len(candidates)-1]
+	}
+
+	const (
+		visiting = iota + 1
+		done
+	)
+
+	var (
+		values = make([]string, len(defs))
+		state  = make([]int, len(defs))
+		path   []int
+		visit  func(i int) error
+	)
+
+	visit = func(i int) error {
+		switch state[i] {
+		case done:
+			return nil
+		case visiting:
+			cycle := make([]string, 0, len(path)+1)
+			for _, j := range path[slices.Index(path, i):] {
+				cycle = append(cycle, defs[j].desc)
+			}
+
+			return fmt.Errorf("parameter reference cycle: %s -> %s", strings.Join(cycle, " -> "), defs[i].desc)
+		}
+
+		d := defs[i]
+
+		if d.param.Literal() {
+			values[i], state[i] = d.param.Value, done
+
+			return nil
+		}
+
+		state[i] = visiting
+		path = append(path, i)
+
+		s, err := v.expandIndex(d.param.Value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", d.desc, err)
+		}
+
+		refs, err := template.Refs(s)
+		if err != nil {
+			return fmt.Errorf("%s: %w", d.desc, err)
+		}
+
+		params := make(map[string]string, len(refs))
+
+		for _, name := range refs {
+			j := target(i, name)
+			if j < 0 {
+				if val, ok := template.Lookup(v.builtin, name); ok {
+					params[name] = val
+				}
+
+				continue
+			}
+
+			if err := visit(j); err != nil {
+				return err
+			}
+
+			params[name] = values[j]
+		}
+
+		if values[i], err = template.ExpandFiltered(s, params, v.secrets.AddDerived); err != nil {
+			return fmt.Errorf("%s: %w", d.desc, err)
+		}
+
+		path = path[:len(path)-1]
+		state[i] = done
+
+		return nil
+	}
+
+	for i := range defs {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+
+	v.defs = defs
+	v.params = maps.Clone(v.builtin)
+	v.global = make(map[string]string)
+	v.team = make(map[string]string)
+
+	for i, d := range defs {
+		v.params[d.param.Name] = values[i]
+
+		switch d.scope {
+		case scopeGlobal:
+			v.global[d.param.Name] = values[i]
+		case scopeTeam:
+			v.team[d.param.Name] = values[i]
+			v.params["team_"+d.param.Name] = values[i]
+		}
+	}
+
+	return values, nil
+}
+
+// value returns expanded parameter value, literal values are returned as is.
+func (v *vars) value(p *Param) (string, error) {
+	if p.Literal() {
+		return p.Value, nil
+	}
+
+	return v.expand(p.Value)
+}
+
+// expand substitutes team index expressions and then parameter references.
+func (v *vars) expand(s string) (string, error) {
+	s, err := v.expandIndex(s)
+	if err != nil {
+		return "", err
+	}
+
+	return template.ExpandFiltered(s, v.params, v.secrets.AddDerived)
+}
+
+// expandIndex substitutes only team index expressions.
+func (v *vars) expandIndex(s string) (string, error) {
+	var (
+		b    strings.Builder
+		last int
+	)
+
+	for _, m := range indexExpr.FindAllStringSubmatchIndex(s, -1) {
+		// Skip parameter references like ${x}.
+		if m[0] > 0 && s[m[0]-1] == '$' {
+			continue
+		}
+
+		val, err := v.evalIndex(s[m[2]:m[3]])
+		if err != nil {
+			return "", err
+		}
+
+		b.WriteString(s[last:m[0]])
+		b.WriteString(val)
+		last = m[1]
+	}
+
+	b.WriteString(s[last:])
+
+	return b.String(), nil
+}
+
+// evalIndex evaluates team index expression without braces.
+func (v *vars) evalIndex(expr string) (string, error) {
+	if strings.Trim(expr, "x") == "" {
+		return fmt.Sprintf("%0*d", len(expr), v.index), nil
+	}
+
+	expr, width, padded := strings.Cut(strings.TrimPrefix(expr, "index"), ":")
+	expr = strings.ReplaceAll(expr, " ", "")
+
+	// Sum of terms, multiplication and division are applied to the last
+	// term so that they are evaluated before addition and subtraction.
+	terms := []int{v.index}
+
+	for expr != "" {
+		op := expr[0]
+
+		i := 1
+		for i < len(expr) && expr[i] >= '0' && expr[i] <= '9' {
+			i++
+		}
+
+		n, err := strconv.Atoi(expr[1:i])
+		if err != nil {
+			return "", fmt.Errorf("invalid team index expression '%s'", expr)
+		}
+
+		expr = expr[i:]
+
+		switch op {
+		case '*':
+			terms[len(terms)-1] *= n
+		case '/':
+			if n == 0 {
+				return "", fmt.Errorf("division by zero in team index expression")
+			}
+
+			terms[len(terms)-1] /= n
+		case '-':
+			terms = append(terms, -n)
+		default:
+			terms = append(terms, n)
+		}
+	}
+
+	res := 0
+	for _, t := range terms {
+		res += t
+	}
+
+	w := 0
+	if padded {
+		var err error
+		if w, err = strconv.Atoi(strings.TrimSpace(width)); err != nil {
+			return "", fmt.Errorf("invalid team index padding '%s'", width)
+		}
+	}
+
+	return fmt.Sprintf("%0*d", w, res), nil
+}
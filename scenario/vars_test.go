@@ -0,0 +1,193 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package scenario
+
+import (
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestEvalIndex(t *testing.T) {
+	tests := []struct {
+		index int
+		expr  string
+		want  string
+		err   string
+	}{
+		{index: 7, expr: "x", want: "7"},
+		{index: 7, expr: "xx", want: "07"},
+		{index: 7, expr: "xxxx", want: "0007"},
+		{index: 123, expr: "xx", want: "123"},
+		{index: 7, expr: "index", want: "7"},
+		{index: 7, expr: "index+10", want: "17"},
+		{index: 7, expr: "index - 2", want: "5"},
+		{index: 7, expr: "index*2+1", want: "15"},
+		{index: 7, expr: "index+1*2", want: "9"},
+		{index: 7, expr: "index/2", want: "3"},
+		{index: 7, expr: "index-10", want: "-3"},
+		{index: 7, expr: "index-10:3", want: "-03"},
+		{index: 7, expr: "index:3", want: "007"},
+		{index: 7, expr: "index*10 : 4", want: "0070"},
+		{index: 7, expr: "index/0", err: "division by zero"},
+		{index: 7, expr: "index+", err: "invalid team index expression"},
+		{index: 7, expr: "index:", err: "invalid team index padding"},
+		{index: 7, expr: "index:a", err: "invalid team index padding"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := (&vars{index: tt.index}).evalIndex(tt.expr)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandIndex(t *testing.T) {
+	v := &vars{index: 3}
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "10.0.{x}.5", want: "10.0.3.5"},
+		{in: "10.0.{index+10}.5", want: "10.0.13.5"},
+		{in: "team{xx}-{index:3}", want: "team03-003"},
+		{in: "${x} ${index}", want: "${x} ${index}"},
+		{in: "{y} {index+a} {}", want: "{y} {index+a} {}"},
+	}
+
+	for _, tt := range tests {
+		got, err := v.expandIndex(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != tt.want {
+			t.Errorf("expandIndex(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNewVars(t *testing.T) {
+	tests := []struct {
+		name   string
+		global []Param
+		team   []Param
+		attack []Param
+		want   map[string]string
+		err    string
+	}{
+		{
+			name:   "global references team",
+			global: []Param{{Name: "url", Value: "http://${web_host}:${port}/"}, {Name: "port", Value: "80"}},
+			team:   []Param{{Name: "web_host", Value: "10.0.{x}.5"}},
+			want:   map[string]string{"url": "http://10.0.2.5:80/", "team_web_host": "10.0.2.5"},
+		},
+		{
+			name:   "team references global",
+			global: []Param{{Name: "domain", Value: "team{x}.lab"}},
+			team:   []Param{{Name: "web", Value: "web.${domain}"}},
+			want:   map[string]string{"web": "web.team2.lab", "team_web": "web.team2.lab"},
+		},
+		{
+			name:   "team overrides global",
+			global: []Param{{Name: "url", Value: "http://${host}/"}, {Name: "host", Value: "default"}},
+			team:   []Param{{Name: "host", Value: "${host}-${team_name}"}},
+			want:   map[string]string{"url": "http://default-Team 2/", "host": "default-Team 2"},
+		},
+		{
+			name:   "attack parameters",
+			global: []Param{{Name: "port", Value: "80"}},
+			team:   []Param{{Name: "host", Value: "10.0.{index}.1"}},
+			attack: []Param{{Name: "target", Value: "${url}"}, {Name: "url", Value: "http://$team_host:${port}"}, {Name: "port", Value: "8080"}},
+			want:   map[string]string{"target": "http://10.0.2.1:8080", "url": "http://10.0.2.1:8080", "port": "8080"},
+		},
+		{
+			name:   "case insensitive",
+			global: []Param{{Name: "Domain", Value: "lab"}, {Name: "host", Value: "web.${domain}"}},
+			want:   map[string]string{"host": "web.lab"},
+		},
+		{
+			name:   "literal",
+			global: []Param{{Name: "password", Value: "p${x}{x}", Type: "secret"}, {Name: "auth", Value: "admin:${password}"}},
+			want:   map[string]string{"auth": "admin:p${x}{x}"},
+		},
+		{
+			name:   "cycle",
+			global: []Param{{Name: "a", Value: "${b}"}},
+			team:   []Param{{Name: "b", Value: "${c}"}, {Name: "c", Value: "$a"}},
+			err:    "parameter reference cycle: global parameter 'a' -> team 'Team 2' parameter 'b' -> team 'Team 2' parameter 'c' -> global parameter 'a'",
+		},
+		{
+			name:   "attack cycle",
+			attack: []Param{{Name: "a", Value: "${a:-x}-${b}"}, {Name: "b", Value: "${a}"}},
+			err:    "parameter reference cycle",
+		},
+		{
+			name:   "self reference",
+			global: []Param{{Name: "a", Value: "${a}"}},
+			err:    "global parameter 'a': undefined parameter 'a'",
+		},
+		{
+			name: "undefined",
+			team: []Param{{Name: "a", Value: "${missing}"}},
+			err:  "team 'Team 2' parameter 'a': undefined parameter 'missing'",
+		},
+		{
+			name:   "invalid index",
+			global: []Param{{Name: "a", Value: "{index/0}"}},
+			err:    "global parameter 'a': division by zero",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := newVars(&Team{Name: "Team 2", Index: 2, Params: tt.team}, tt.global, nil)
+
+			var params map[string]string
+			if err == nil {
+				host := &Host{Name: "web", Attacks: []Attack{{Name: "scan", Params: tt.attack}}}
+
+				var attack map[string]string
+				if v, attack, err = v.forAttack(host, &host.Attacks[0]); err == nil {
+					params = maps.Clone(v.params)
+					maps.Copy(params, attack)
+				}
+			}
+
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for k, want := range tt.want {
+				if params[k] != want {
+					t.Errorf("%s = %q, want %q", k, params[k], want)
+				}
+			}
+		})
+	}
+}
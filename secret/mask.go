@@ -0,0 +1,98 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+// Package secret resolves secret values from external sources and masks them in output.
+package secret
+
+import (
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Mask is the replacement of secret values.
+const Mask = "******"
+
+// Masker replaces secret values in text. Nil masker does not mask anything.
+type Masker struct {
+	mu       sync.RWMutex
+	secrets  []string
+	replacer *strings.Replacer
+}
+
+// NewMasker returns masker for secret values.
+func NewMasker(values ...string) *Masker {
+	m := &Masker{}
+	m.Add(values...)
+
+	return m
+}
+
+// Add adds secret values to mask, empty values are ignored.
+func (m *Masker) Add(values ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, v := range values {
+		if v != "" && !slices.Contains(m.secrets, v) {
+			m.secrets = append(m.secrets, v)
+		}
+	}
+
+	// Replace longer secrets first so that secrets containing other secrets are fully masked.
+	slices.SortFunc(m.secrets, func(a, b string) int {
+		return len(b) - len(a)
+	})
+
+	pairs := make([]string, 0, len(m.secrets)*2)
+	for _, s := range m.secrets {
+		pairs = append(pairs, s, Mask)
+	}
+
+	m.replacer = strings.NewReplacer(pairs...)
+}
+
+// AddDerived adds value derived from other value, e.g. encoded, as secret if
+// the original value contains any secret.
+func (m *Masker) AddDerived(value, derived string) {
+	if m == nil || value == derived || m.Mask(value) == value {
+		return
+	}
+
+	m.Add(derived)
+}
+
+// Mask returns s with secret values masked.
+func (m *Masker) Mask(s string) string {
+	if m == nil {
+		return s
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.replacer == nil {
+		return s
+	}
+
+	return m.replacer.Replace(s)
+}
+
+// MaskBytes returns data with secret values masked.
+func (m *Masker) MaskBytes(data []byte) []byte {
+	if m == nil || len(data) == 0 {
+		return data
+	}
+
+	return []byte(m.Mask(string(data)))
+}
+
+// MaskValues returns copy of values with secret values masked.
+func (m *Masker) MaskValues(values map[string]string) map[string]string {
+	res := make(map[string]string, len(values))
+	for k, v := range values {
+		res[k] = m.Mask(v)
+	}
+
+	return res
+}
@@ -0,0 +1,30 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package secret
+
+import "testing"
+
+func TestMasker(t *testing.T) {
+	m := NewMasker("pass", "password", "")
+
+	if got, want := m.Mask("user password pass"), "user ****** ******"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	m.AddDerived("password", "cGFzc3dvcmQ=")
+	m.AddDerived("url?p=pass", "url%3Fp%3Dpass")
+	m.AddDerived("admin", "YWRtaW4=")
+
+	if got, want := m.Mask("cGFzc3dvcmQ= url%3Fp%3Dpass YWRtaW4="), "****** ****** YWRtaW4="; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	var nilMasker *Masker
+
+	nilMasker.AddDerived("password", "cGFzc3dvcmQ=")
+
+	if got := nilMasker.Mask("password"); got != "password" {
+		t.Errorf("nil masker masked %q", got)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package secret
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/goccy/go-yaml"
+)
+
+// AgeKeyFileEnv is the environment variable with path to age identity file.
+// SOPS_AGE_KEY_FILE is used if it is not set.
+const AgeKeyFileEnv = "VILKS_AGE_KEY_FILE"
+
+// FromEnv returns value of environment variable.
+func FromEnv(name string) (string, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable '%s' is not set", name)
+	}
+
+	return v, nil
+}
+
+// FromFile returns file contents without trailing new line, or value of
+// dot separated key if file is YAML or JSON document. Files with .age
+// extension are decrypted with age identity and sops encrypted files are
+// decrypted using sops command.
+func FromFile(path, key string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case strings.HasSuffix(path, ".age"):
+		if data, err = decryptAge(data); err != nil {
+			return "", fmt.Errorf("failed to decrypt '%s': %w", path, err)
+		}
+	case isSops(data):
+		if data, err = decryptSops(path); err != nil {
+			return "", fmt.Errorf("failed to decrypt '%s': %w", path, err)
+		}
+	}
+
+	if key == "" {
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return "", fmt.Errorf("failed to parse '%s': %w", path, err)
+	}
+
+	return lookupKey(doc, key)
+}
+
+func lookupKey(doc any, key string) (string, error) {
+	v := doc
+
+	for _, k := range strings.Split(key, ".") {
+		switch val := v.(type) {
+		case map[string]any:
+			var ok bool
+			if v, ok = val[k]; !ok {
+				return "", fmt.Errorf("key '%s' not found", key)
+			}
+		case []any:
+			i, err := strconv.Atoi(k)
+			if err != nil || i < 0 || i >= len(val) {
+				return "", fmt.Errorf("key '%s' not found", key)
+			}
+
+			v = val[i]
+		default:
+			return "", fmt.Errorf("key '%s' not found", key)
+		}
+	}
+
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case map[string]any, []any, nil:
+		return "", fmt.Errorf("key '%s' is not a value", key)
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+func decryptAge(data []byte) ([]byte, error) {
+	keyFile := os.Getenv(AgeKeyFileEnv)
+	if keyFile == "" {
+		keyFile = os.Getenv("SOPS_AGE_KEY_FILE")
+	}
+
+	if keyFile == "" {
+		return nil, fmt.Errorf("age identity file is not set, use %s environment variable", AgeKeyFileEnv)
+	}
+
+	f, err := os.Open(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ids, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var in io.Reader = bytes.NewReader(data)
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(armor.Header)) {
+		in = armor.NewReader(bytes.NewReader(bytes.TrimSpace(data)))
+	}
+
+	r, err := age.Decrypt(in, ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(r)
+}
+
+// isSops returns true if data is YAML or JSON document with sops metadata.
+func isSops(data []byte) bool {
+	var doc map[string]any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return false
+	}
+
+	_, ok := doc["sops"]
+
+	return ok
+}
+
+func decryptSops(path string) ([]byte, error) {
+	var stderr bytes.Buffer
+
+	cmd := exec.Command("sops", "--decrypt", path)
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := firstLine(stderr.Bytes()); msg != "" {
+			return nil, errors.New(msg)
+		}
+
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func firstLine(data []byte) string {
+	s := bufio.NewScanner(bytes.NewReader(data))
+	if s.Scan() {
+		return strings.TrimSpace(s.Text())
+	}
+
+	return ""
+}
@@ -0,0 +1,214 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+// Package template implements strict parameter substitution.
+//
+// References are written as ${name} or $name and fail on undefined names.
+// Default value can be provided as ${name:-default}, it is used when parameter
+// is undefined or empty. Value can be passed through filters, for example
+// ${target_host | shellquote}.
+// Literal dollar sign is written as $$, so shell variables must be written as
+// $$VAR or $${VAR}. Dollar sign not followed by name or brace is kept as is.
+package template
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Filter transforms substituted value.
+type Filter func(string) string
+
+// Filters are the available value filters.
+var Filters = map[string]Filter{
+	"shellquote": ShellQuote,
+	"urlencode":  url.QueryEscape,
+	"base64": func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	},
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+}
+
+// ShellQuote quotes string to be used as single shell argument.
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Expand substitutes parameter references in s with values from params.
+func Expand(s string, params map[string]string) (string, error) {
+	return ExpandFiltered(s, params, nil)
+}
+
+// ExpandFiltered substitutes parameter references in s with values from params
+// and calls filtered with value and result of every reference passed through
+// filters, e.g. to mask encoded secret values.
+func ExpandFiltered(s string, params map[string]string, filtered func(value, result string)) (string, error) {
+	return expand(s, func(name string) (string, bool) {
+		return Lookup(params, name)
+	}, filtered)
+}
+
+// Validate checks that s is a valid template.
+func Validate(s string) error {
+	_, err := expand(s, func(string) (string, bool) {
+		return "", true
+	}, nil)
+
+	return err
+}
+
+// Refs returns names of parameters referenced in s.
+func Refs(s string) ([]string, error) {
+	var refs []string
+
+	_, err := expand(s, func(name string) (string, bool) {
+		refs = append(refs, name)
+
+		return "", true
+	}, nil)
+
+	return refs, err
+}
+
+// Lookup returns parameter value by exact name or case-insensitive match.
+func Lookup(params map[string]string, name string) (string, bool) {
+	if v, ok := params[name]; ok {
+		return v, true
+	}
+
+	for k, v := range params {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+
+	return "", false
+}
+
+func expand(s string, lookup func(string) (string, bool), filtered func(value, result string)) (string, error) {
+	var b strings.Builder
+
+	for {
+		i := strings.IndexByte(s, '$')
+		if i < 0 || i == len(s)-1 {
+			b.WriteString(s)
+
+			return b.String(), nil
+		}
+
+		b.WriteString(s[:i])
+		s = s[i+1:]
+
+		switch s[0] {
+		case '$':
+			b.WriteByte('$')
+			s = s[1:]
+		case '{':
+			end := strings.IndexByte(s, '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated reference '$%s'", s)
+			}
+
+			v, err := evaluate(s[1:end], lookup, filtered)
+			if err != nil {
+				return "", err
+			}
+
+			b.WriteString(v)
+			s = s[end+1:]
+		default:
+			n := bareName(s)
+			if n == 0 {
+				b.WriteByte('$')
+
+				continue
+			}
+
+			v, err := evaluate(s[:n], lookup, filtered)
+			if err != nil {
+				return "", err
+			}
+
+			b.WriteString(v)
+			s = s[n:]
+		}
+	}
+}
+
+// evaluate returns value of a single reference.
+func evaluate(ref string, lookup func(string) (string, bool), filtered func(value, result string)) (string, error) {
+	parts := strings.Split(ref, "|")
+
+	expr := strings.TrimSpace(parts[0])
+
+	name, def, hasDef := strings.Cut(expr, ":-")
+	name = strings.TrimSpace(name)
+
+	if !isName(name) {
+		return "", fmt.Errorf("invalid reference '${%s}'", ref)
+	}
+
+	v, ok := lookup(name)
+
+	switch {
+	case hasDef && v == "":
+		v = def
+	case !ok:
+		return "", fmt.Errorf("undefined parameter '%s'", name)
+	}
+
+	res := v
+
+	for _, f := range parts[1:] {
+		f = strings.TrimSpace(f)
+
+		fn, ok := Filters[f]
+		if !ok {
+			return "", fmt.Errorf("unknown filter '%s' in '${%s}'", f, ref)
+		}
+
+		res = fn(res)
+	}
+
+	if filtered != nil && len(parts) > 1 {
+		filtered(v, res)
+	}
+
+	return res, nil
+}
+
+// isName returns true if s is valid parameter name. Dots and dashes are
+// allowed to reference nested values like step outputs.
+func isName(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '.' || r == '-') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// bareName returns length of parameter name referenced without braces at the
+// start of s. Same as in shell name must start with letter or underscore and
+// can contain only letters, digits and underscores.
+func bareName(s string) int {
+	for i, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '_':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return i
+		}
+	}
+
+	return len(s)
+}
@@ -0,0 +1,134 @@
+// Copyright 2024 Lauris BH, Janis Janusjavics. All rights reserved.
+// SPDX-License-Identifier: GPL-3.0
+
+package template
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	params := map[string]string{
+		"target_host": "10.0.0.5",
+		"Target_Port": "8080",
+		"user":        "O'Brien",
+		"empty":       "",
+		"query":       "a b&c",
+		"step.out-1":  "ok",
+	}
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+		err  string
+	}{
+		{name: "plain", in: "echo hello", want: "echo hello"},
+		{name: "reference", in: "nmap ${target_host}", want: "nmap 10.0.0.5"},
+		{name: "spaces", in: "${ target_host }", want: "10.0.0.5"},
+		{name: "nested name", in: "${step.out-1}", want: "ok"},
+		{name: "case insensitive", in: "${target_port}", want: "8080"},
+		{name: "exact case first", in: "${Target_Port}", want: "8080"},
+		{name: "default undefined", in: "${port:-80}", want: "80"},
+		{name: "default empty", in: "${empty:-none}", want: "none"},
+		{name: "default set", in: "${target_port:-80}", want: "8080"},
+		{name: "default empty value", in: "[${port:-}]", want: "[]"},
+		{name: "filter", in: "${user | shellquote}", want: `'O'\''Brien'`},
+		{name: "filter chain", in: "${user|lower|base64}", want: "bydicmllbg=="},
+		{name: "urlencode", in: "?q=${query | urlencode}", want: "?q=a+b%26c"},
+		{name: "default filter", in: "${port:-Eighty | upper}", want: "EIGHTY"},
+		{name: "trim", in: "${query:- x | trim}", want: "a b&c"},
+		{name: "bare", in: "nmap $target_host -p $Target_Port", want: "nmap 10.0.0.5 -p 8080"},
+		{name: "bare name end", in: "$user's $target_host.lab", want: "O'Brien's 10.0.0.5.lab"},
+		{name: "bare case insensitive", in: "$TARGET_HOST", want: "10.0.0.5"},
+		{name: "escaped", in: "echo $$HOME $${PATH} $$$target_host", want: "echo $HOME ${PATH} $10.0.0.5"},
+		{name: "dollar kept", in: "echo $1 $? $(id) 5$ end$", want: "echo $1 $? $(id) 5$ end$"},
+		{name: "undefined", in: "${port}", err: "undefined parameter 'port'"},
+		{name: "bare undefined", in: "echo $HOME", err: "undefined parameter 'HOME'"},
+		{name: "unterminated", in: "${target_host", err: "unterminated reference"},
+		{name: "invalid name", in: "${target host}", err: "invalid reference '${target host}'"},
+		{name: "empty reference", in: "${}", err: "invalid reference"},
+		{name: "unknown filter", in: "${user | rot13}", err: "unknown filter 'rot13'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Expand(tt.in, params)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for in, ok := range map[string]bool{
+		"${anything} $bare $$HOME": true,
+		"${a:-b | shellquote}":     true,
+		"${a | nope}":              false,
+		"${a":                      false,
+		"${a b}":                   false,
+	} {
+		if err := Validate(in); (err == nil) != ok {
+			t.Errorf("Validate(%q) = %v, want ok %t", in, err, ok)
+		}
+	}
+}
+
+func TestRefs(t *testing.T) {
+	refs, err := Refs("${a} $b $$c ${d:-x | upper} ${steps.scan.port} $1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"a", "b", "d", "steps.scan.port"}; !slices.Equal(refs, want) {
+		t.Errorf("refs = %v, want %v", refs, want)
+	}
+}
+
+func TestExpandFiltered(t *testing.T) {
+	params := map[string]string{"password": "s3cr et", "user": "admin"}
+
+	filtered := make(map[string]string)
+
+	got, err := ExpandFiltered("$user:${password} ${password | base64} ${user | upper} ${password|urlencode|shellquote}", params, func(value, result string) {
+		filtered[result] = value
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "admin:s3cr et czNjciBldA== ADMIN 's3cr+et'"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	want := map[string]string{
+		"czNjciBldA==": "s3cr et",
+		"ADMIN":        "admin",
+		"'s3cr+et'":    "s3cr et",
+	}
+
+	if len(filtered) != len(want) {
+		t.Errorf("filtered = %v, want %v", filtered, want)
+	}
+
+	for result, value := range want {
+		if filtered[result] != value {
+			t.Errorf("filtered %q = %q, want %q", result, filtered[result], value)
+		}
+	}
+}